@@ -1,32 +1,110 @@
 package alerts
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/expr"
+	"github.com/vcavallo/asset-alerts/message"
+	"github.com/vcavallo/asset-alerts/period"
 	"github.com/vcavallo/asset-alerts/state"
 	"github.com/vcavallo/asset-alerts/yahoo"
 )
 
 // TriggeredAlert represents an alert that should be sent
 type TriggeredAlert struct {
-	Ticker    string
-	Name      string
-	Condition config.ConditionConfig
-	Price     float64
-	Message   string
+	Key            string // state key identifying the condition
+	Ticker         string
+	Name           string
+	Alert          config.AlertConfig // the alert definition, for per-alert routing
+	Condition      config.ConditionConfig
+	Price          float64
+	ReferencePrice float64 // last price for thresholds, historical price for changes (0 if unknown)
+	Direction      string  // "up" or "down"
+	Currency       string
+	Title          string // custom title rendered from the condition, empty for the notifier default
+	Message        string
+	Reminder       bool // repeated notification for a condition that is still active
+	Timestamp      time.Time
+}
+
+// DisplayName returns the alert name, falling back to the ticker
+func (t TriggeredAlert) DisplayName() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Ticker
+}
+
+// Change returns the price change against the reference price
+func (t TriggeredAlert) Change() (float64, bool) {
+	if t.ReferencePrice == 0 {
+		return 0, false
+	}
+	return t.Price - t.ReferencePrice, true
+}
+
+// PercentChange returns the percent change against the reference price
+func (t TriggeredAlert) PercentChange() (float64, bool) {
+	change, ok := t.Change()
+	if !ok {
+		return 0, false
+	}
+	return change / t.ReferencePrice * 100, true
+}
+
+// ChangeText describes the move against the reference price, e.g. "+2.50% (+$1.25)"
+func (t TriggeredAlert) ChangeText() string {
+	change, ok := t.Change()
+	if !ok {
+		return "n/a"
+	}
+	percent, _ := t.PercentChange()
+
+	sign := "+"
+	if change < 0 {
+		sign = "-"
+	}
+
+	return fmt.Sprintf("%s%.2f%% (%s$%.2f)", sign, math.Abs(percent), sign, math.Abs(change))
+}
+
+// Summary returns a title for a group of alerts, e.g. "5 alerts: BTC-USD, ETH-USD, AAPL…"
+func Summary(triggered []TriggeredAlert) string {
+	const maxTickers = 3
+
+	var tickers []string
+	seen := make(map[string]bool)
+	for _, t := range triggered {
+		if !seen[t.Ticker] {
+			seen[t.Ticker] = true
+			tickers = append(tickers, t.Ticker)
+		}
+	}
+
+	list := strings.Join(tickers, ", ")
+	if len(tickers) > maxTickers {
+		list = strings.Join(tickers[:maxTickers], ", ") + "…"
+	}
+
+	return fmt.Sprintf("%d alerts: %s", len(triggered), list)
 }
 
 // Evaluator checks alert conditions against prices
 type Evaluator struct {
-	state *state.State
+	state   *state.State
+	verbose bool
 }
 
-// NewEvaluator creates a new alert evaluator
-func NewEvaluator(s *state.State) *Evaluator {
-	return &Evaluator{state: s}
+// NewEvaluator creates a new alert evaluator. With verbose set it also logs
+// conditions that can't be evaluated yet for lack of history.
+func NewEvaluator(s *state.State, verbose bool) *Evaluator {
+	return &Evaluator{state: s, verbose: verbose}
 }
 
 // Evaluate checks all alert conditions and returns triggered alerts
@@ -50,170 +128,308 @@ func (e *Evaluator) Evaluate(alerts []config.AlertConfig, quotes map[string]*yah
 }
 
 func (e *Evaluator) evaluateCondition(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) *TriggeredAlert {
+	r, ok := e.read(alert, cond, quote)
+	if !ok {
+		// Not enough history yet
+		return nil
+	}
+
+	key := ConditionKey(alert.Ticker, cond)
+	fire, reminder := e.step(key, cond, r.signal, e.previous(alert.Ticker, key, cond))
+	if !fire {
+		return nil
+	}
+
+	var msg string
 	switch cond.Type {
-	case "above":
-		return e.evaluateAbove(alert, cond, quote)
-	case "below":
-		return e.evaluateBelow(alert, cond, quote)
+	case "above", "below":
+		msg = e.formatMessage(alert, cond, quote.Price, cond.Type)
 	case "percent_change":
-		return e.evaluatePercentChange(alert, cond, quote)
+		msg = e.formatPercentMessage(alert, cond, quote.Price, r.change, r.direction)
 	case "absolute_change":
-		return e.evaluateAbsoluteChange(alert, cond, quote)
+		msg = e.formatAbsoluteMessage(alert, cond, quote.Price, r.change, r.direction)
+	case "sma_cross", "ema_cross", "rsi", "bollinger", "macd", "atr":
+		msg = e.formatIndicatorMessage(alert, cond, quote.Price, r.indicator, r.direction)
+	case "volume_spike", "unusual_volume":
+		msg = e.formatVolumeMessage(alert, cond, quote.Price, r.volume)
+	case "new_52w_high", "new_52w_low", "near_52w_high", "new_all_time_high":
+		msg = e.formatRecordMessage(alert, cond, quote.Price, r.record)
+	case "trailing_stop", "drawdown":
+		msg = e.formatTrailingMessage(alert, cond, quote.Price, r.trailing)
+	default:
+		msg = e.formatConditionMessage(alert, cond, quote.Price)
 	}
-	return nil
+
+	return e.newTriggeredAlert(key, alert, cond, quote, r.reference, r.direction, msg).markReminder(reminder)
+}
+
+// ConditionKey identifies a condition in state by its whole definition, so
+// that conditions differing only in period or trigger settings each have
+// their own state, and editing a condition starts a fresh one. Trigger
+// settings left at their defaults are omitted, e.g. "BTC-USD:above:100000.00"
+// or "BTC-USD:percent_change:5.00:24h:cross::1h".
+func ConditionKey(ticker string, cond config.ConditionConfig) string {
+	key := ticker + ":" + cond.Canonical()
+	triggerOn := cond.TriggerOn
+	if triggerOn == "" {
+		triggerOn = "level"
+	}
+	if triggerOn != "level" || cond.ResetBand != "" || cond.Cooldown != "" {
+		key += fmt.Sprintf(":%s:%s:%s", triggerOn, cond.ResetBand, cond.Cooldown)
+	}
+	return key
 }
 
-func (e *Evaluator) evaluateAbove(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) *TriggeredAlert {
-	key := state.AlertKey(alert.Ticker, "above", cond.Value)
-	lastPrice, hasLast := e.state.GetLastPrice(alert.Ticker)
-
-	// Check if price is above threshold
-	isAbove := quote.Price >= cond.Value
-
-	// Check if we've already triggered this alert
-	alreadyTriggered := e.state.IsAlertTriggered(key)
-
-	if isAbove {
-		if !alreadyTriggered {
-			// Price crossed above threshold - trigger alert
-			e.state.SetAlertTriggered(key, true)
-			return &TriggeredAlert{
-				Ticker:    alert.Ticker,
-				Name:      alert.Name,
-				Condition: cond,
-				Price:     quote.Price,
-				Message:   e.formatMessage(alert, cond, quote.Price, "above"),
+// LegacyKeys maps the keys conditions had in older state files to their
+// current keys, for State.MigrateKeys. Threshold and change conditions were
+// keyed by type and value alone, and other conditions by their definition
+// without trigger settings.
+func LegacyKeys(alertCfgs []config.AlertConfig) map[string][]string {
+	renames := make(map[string][]string)
+	for _, alert := range alertCfgs {
+		for _, cond := range alert.Conditions {
+			legacy := alert.Ticker + ":" + cond.Canonical()
+			switch cond.Type {
+			case "above", "below", "percent_change", "absolute_change":
+				legacy = state.AlertKey(alert.Ticker, cond.Type, cond.Value)
+			}
+			if key := ConditionKey(alert.Ticker, cond); key != legacy {
+				renames[legacy] = append(renames[legacy], key)
 			}
-		}
-	} else {
-		// Price is below threshold - reset the alert if it was triggered
-		// This implements hysteresis: alert can fire again if price drops and rises
-		if alreadyTriggered && hasLast && lastPrice >= cond.Value {
-			e.state.SetAlertTriggered(key, false)
 		}
 	}
+	return renames
+}
 
-	return nil
+// reading is a condition's evaluation on one check. Indicator, volume,
+// record and trailing conditions also fill in their own details for the
+// message.
+type reading struct {
+	signal    signal
+	reference float64 // last price for thresholds, historical price for changes
+	change    float64 // signed change against reference, in the condition's unit (percent or dollars)
+	direction string  // "up" or "down"
+
+	indicator indicatorReading
+	volume    volumeReading
+	record    recordReading
+	trailing  trailingReading
 }
 
-func (e *Evaluator) evaluateBelow(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) *TriggeredAlert {
-	key := state.AlertKey(alert.Ticker, "below", cond.Value)
-	lastPrice, hasLast := e.state.GetLastPrice(alert.Ticker)
-
-	// Check if price is below threshold
-	isBelow := quote.Price <= cond.Value
-
-	// Check if we've already triggered this alert
-	alreadyTriggered := e.state.IsAlertTriggered(key)
-
-	if isBelow {
-		if !alreadyTriggered {
-			// Price crossed below threshold - trigger alert
-			e.state.SetAlertTriggered(key, true)
-			return &TriggeredAlert{
-				Ticker:    alert.Ticker,
-				Name:      alert.Name,
-				Condition: cond,
-				Price:     quote.Price,
-				Message:   e.formatMessage(alert, cond, quote.Price, "below"),
-			}
+// read evaluates a condition against the quote. It reports false when the
+// condition doesn't have enough history yet.
+func (e *Evaluator) read(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) (reading, bool) {
+	if cond.Operator() != "" {
+		return e.readCompound(alert, cond, quote), true
+	}
+
+	switch cond.Type {
+	case "above", "below":
+		lastPrice, _ := e.state.GetLastPrice(alert.Ticker)
+		direction := "up"
+		if cond.Type == "below" {
+			direction = "down"
+		}
+		return reading{signal: thresholdSignal(cond, quote.Price), reference: lastPrice, direction: direction}, true
+
+	case "percent_change", "absolute_change":
+		duration, err := period.Parse(cond.Period)
+		if err != nil {
+			return reading{}, false
 		}
-	} else {
-		// Price is above threshold - reset the alert if it was triggered
-		if alreadyTriggered && hasLast && lastPrice <= cond.Value {
-			e.state.SetAlertTriggered(key, false)
+		histPrice, ok := e.state.GetPriceAtTime(alert.Ticker, duration)
+		if !ok {
+			return reading{}, false
+		}
+
+		change := quote.Price - histPrice
+		if cond.Type == "percent_change" {
+			change = (quote.Price - histPrice) / histPrice * 100
 		}
+		direction := "up"
+		if change < 0 {
+			direction = "down"
+		}
+		return reading{signal: changeSignal(cond, math.Abs(change)), reference: histPrice, change: change, direction: direction}, true
+
+	case "expression":
+		return e.readExpression(alert, cond, quote)
+
+	case "sma_cross", "ema_cross", "rsi", "bollinger", "macd", "atr":
+		return e.readIndicator(alert, cond, quote)
+
+	case "volume_spike", "unusual_volume":
+		return e.readVolume(alert, cond, quote)
+
+	case "new_52w_high", "new_52w_low", "near_52w_high", "new_all_time_high":
+		return e.readRecord(alert, cond, quote)
+
+	case "trailing_stop", "drawdown":
+		return e.readTrailing(alert, cond, quote)
 	}
 
-	return nil
+	return reading{}, false
 }
 
-func (e *Evaluator) evaluatePercentChange(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) *TriggeredAlert {
-	duration, err := parseDuration(cond.Period)
+// readExpression evaluates an expression condition against the ticker's
+// recorded history. It reports false while the history is too short.
+func (e *Evaluator) readExpression(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) (reading, bool) {
+	x, err := expr.Parse(cond.Expression)
 	if err != nil {
-		return nil
+		log.Printf("Invalid expression for %s: %v", alert.Ticker, err)
+		return reading{}, false
 	}
 
-	histPrice, ok := e.state.GetPriceAtTime(alert.Ticker, duration)
-	if !ok {
-		// Not enough history yet
-		return nil
+	records := e.state.PriceHistory[alert.Ticker]
+	env := &expr.Env{
+		Now:     time.Now(),
+		Price:   quote.Price,
+		History: make([]expr.Sample, 0, len(records)),
+	}
+	for _, r := range records {
+		env.History = append(env.History, expr.Sample{Time: r.Timestamp, Price: r.Price})
 	}
 
-	// Calculate percent change
-	percentChange := ((quote.Price - histPrice) / histPrice) * 100
-	absChange := math.Abs(percentChange)
+	holds, err := x.Eval(env)
+	if err != nil {
+		switch {
+		case !errors.Is(err, expr.ErrInsufficientHistory):
+			log.Printf("Failed to evaluate expression for %s: %v", alert.Ticker, err)
+		case e.verbose:
+			log.Printf("Not enough price history yet for %s expression %q", alert.Ticker, cond.Expression)
+		}
+		return reading{}, false
+	}
 
-	key := state.AlertKey(alert.Ticker, "percent_change", cond.Value)
-	alreadyTriggered := e.state.IsAlertTriggered(key)
+	lastPrice, _ := e.state.GetLastPrice(alert.Ticker)
+	r := reading{signal: signalClear, reference: lastPrice, direction: "up"}
+	if holds {
+		r.signal = signalActive
+	}
+	if quote.Price < lastPrice {
+		r.direction = "down"
+	}
+	return r, true
+}
 
-	if absChange >= cond.Value {
-		if !alreadyTriggered {
-			e.state.SetAlertTriggered(key, true)
-			direction := "up"
-			if percentChange < 0 {
-				direction = "down"
-			}
-			return &TriggeredAlert{
-				Ticker:    alert.Ticker,
-				Name:      alert.Name,
-				Condition: cond,
-				Price:     quote.Price,
-				Message:   e.formatPercentMessage(alert, cond, quote.Price, percentChange, direction),
-			}
+// readCompound combines the readings of a compound condition's children
+// using three-valued logic, where a child inside its reset band (or without
+// enough history) is undecided:
+//
+//	all: active if every child is active, clear if any child is clear
+//	any: active if any child is active, clear if every child is clear
+//	not: swaps active and clear
+//
+// The reference price and direction come from the first active child.
+func (e *Evaluator) readCompound(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) reading {
+	children := cond.Children()
+	readings := make([]reading, 0, len(children))
+	for _, child := range children {
+		r, ok := e.read(alert, child, quote)
+		if !ok {
+			r = reading{signal: signalBand}
+		}
+		readings = append(readings, r)
+	}
+
+	var combined signal
+	switch cond.Operator() {
+	case "all":
+		combined = signalActive
+		for _, r := range readings {
+			combined = min(combined, r.signal)
+		}
+	case "any":
+		combined = signalClear
+		for _, r := range readings {
+			combined = max(combined, r.signal)
 		}
-	} else {
-		// Reset if change has decreased below threshold
-		if alreadyTriggered {
-			e.state.SetAlertTriggered(key, false)
+	case "not":
+		combined = signalActive - readings[0].signal
+	}
+
+	result := readings[0]
+	for _, r := range readings {
+		if r.signal == signalActive {
+			result = r
+			break
 		}
 	}
+	if result.direction == "" {
+		result.direction = "up"
+	}
+	result.signal = combined
 
-	return nil
+	return result
 }
 
-func (e *Evaluator) evaluateAbsoluteChange(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) *TriggeredAlert {
-	duration, err := parseDuration(cond.Period)
-	if err != nil {
-		return nil
+// markReminder flags a repeated notification for a condition that is still active
+func (t *TriggeredAlert) markReminder(reminder bool) *TriggeredAlert {
+	if reminder {
+		t.Reminder = true
+		t.Message = "Reminder: " + t.Message
 	}
+	return t
+}
 
-	histPrice, ok := e.state.GetPriceAtTime(alert.Ticker, duration)
-	if !ok {
-		// Not enough history yet
-		return nil
+// newTriggeredAlert builds a triggered alert, rendering the condition's
+// message and title templates if it has them
+func (e *Evaluator) newTriggeredAlert(key string, alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote, reference float64, direction, msg string) *TriggeredAlert {
+	t := &TriggeredAlert{
+		Key:            key,
+		Ticker:         alert.Ticker,
+		Name:           alert.Name,
+		Alert:          alert,
+		Condition:      cond,
+		Price:          quote.Price,
+		ReferencePrice: reference,
+		Direction:      direction,
+		Currency:       quote.Currency,
+		Message:        msg,
+		Timestamp:      time.Now(),
 	}
 
-	// Calculate absolute change
-	absoluteChange := quote.Price - histPrice
-	absChange := math.Abs(absoluteChange)
-
-	key := state.AlertKey(alert.Ticker, "absolute_change", cond.Value)
-	alreadyTriggered := e.state.IsAlertTriggered(key)
+	if !message.IsTemplate(cond.Message) && cond.Title == "" {
+		return t
+	}
 
-	if absChange >= cond.Value {
-		if !alreadyTriggered {
-			e.state.SetAlertTriggered(key, true)
-			direction := "up"
-			if absoluteChange < 0 {
-				direction = "down"
-			}
-			return &TriggeredAlert{
-				Ticker:    alert.Ticker,
-				Name:      alert.Name,
-				Condition: cond,
-				Price:     quote.Price,
-				Message:   e.formatAbsoluteMessage(alert, cond, quote.Price, absoluteChange, direction),
-			}
+	data := t.templateData()
+	if message.IsTemplate(cond.Message) {
+		if rendered, err := message.Render(cond.Message, data); err != nil {
+			log.Printf("Failed to render message for %s: %v", key, err)
+		} else {
+			t.Message = rendered
 		}
-	} else {
-		// Reset if change has decreased below threshold
-		if alreadyTriggered {
-			e.state.SetAlertTriggered(key, false)
+	}
+	if cond.Title != "" {
+		if rendered, err := message.Render(cond.Title, data); err != nil {
+			log.Printf("Failed to render title for %s: %v", key, err)
+		} else {
+			t.Title = rendered
 		}
 	}
 
-	return nil
+	return t
+}
+
+// templateData exposes the alert to message and title templates
+func (t TriggeredAlert) templateData() message.Data {
+	data := message.Data{
+		Ticker:         t.Ticker,
+		Name:           t.DisplayName(),
+		Price:          t.Price,
+		Threshold:      t.Condition.Value,
+		ReferencePrice: t.ReferencePrice,
+		Period:         t.Condition.Period,
+		Direction:      t.Direction,
+		Currency:       t.Currency,
+		Timestamp:      t.Timestamp,
+	}
+	if change, ok := t.Change(); ok {
+		data.AbsoluteChange = change
+		data.PercentChange, _ = t.PercentChange()
+	}
+	return data
 }
 
 func (e *Evaluator) formatMessage(alert config.AlertConfig, cond config.ConditionConfig, price float64, direction string) string {
@@ -262,17 +478,16 @@ func (e *Evaluator) formatAbsoluteMessage(alert config.AlertConfig, cond config.
 	return fmt.Sprintf("%s moved $%.2f %s in %s (currently $%.2f)", name, math.Abs(change), direction, cond.Period, price)
 }
 
-// parseDuration converts period strings like "24h", "1h", "7d" to time.Duration
-func parseDuration(period string) (time.Duration, error) {
-	// Handle day suffix
-	if len(period) > 1 && period[len(period)-1] == 'd' {
-		var days int
-		if _, err := fmt.Sscanf(period, "%dd", &days); err != nil {
-			return 0, err
-		}
-		return time.Duration(days) * 24 * time.Hour, nil
+// formatConditionMessage describes compound and expression conditions
+func (e *Evaluator) formatConditionMessage(alert config.AlertConfig, cond config.ConditionConfig, price float64) string {
+	if cond.Message != "" {
+		return fmt.Sprintf("%s (currently $%.2f)", cond.Message, price)
+	}
+
+	name := alert.Name
+	if name == "" {
+		name = alert.Ticker
 	}
 
-	// Standard Go duration parsing for hours, minutes, etc.
-	return time.ParseDuration(period)
+	return fmt.Sprintf("%s: %s (currently $%.2f)", name, cond.Describe(), price)
 }
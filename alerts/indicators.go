@@ -0,0 +1,161 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/indicators"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// indicatorReading is what an indicator condition compared
+type indicatorReading struct {
+	fast, slow float64              // sma_cross and ema_cross: the two averages
+	macd       indicators.MACDValue // macd: the MACD and signal lines
+	level      float64              // rsi and atr: the indicator's value
+	band       float64              // bollinger: the band the price is compared with
+}
+
+// readIndicator evaluates an indicator condition on the ticker's history
+// resampled into bars, the last of which is still forming and closes at the
+// current price. It reports false until there are enough bars.
+func (e *Evaluator) readIndicator(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) (reading, bool) {
+	bars := indicators.Resample(e.points(alert.Ticker, quote.Price), cond.IntervalPeriod())
+	if len(bars) < cond.Bars() {
+		return reading{}, false
+	}
+	closes := indicators.Closes(bars)
+	prev := closes[:len(closes)-1]
+
+	r := reading{reference: prev[len(prev)-1]}
+
+	switch cond.Type {
+	case "sma_cross", "ema_cross":
+		average := indicators.SMA
+		if cond.Type == "ema_cross" {
+			average = indicators.EMA
+		}
+		prevFast, _ := average(prev, cond.Fast)
+		prevSlow, _ := average(prev, cond.Slow)
+		r.indicator.fast, _ = average(closes, cond.Fast)
+		r.indicator.slow, _ = average(closes, cond.Slow)
+		r.signal, r.direction = crossSignal(cond.Direction, prevFast-prevSlow, r.indicator.fast-r.indicator.slow)
+
+	case "macd":
+		before, _ := indicators.MACD(prev, cond.Fast, cond.Slow, cond.Signal)
+		now, _ := indicators.MACD(closes, cond.Fast, cond.Slow, cond.Signal)
+		r.indicator.macd = now
+		r.signal, r.direction = crossSignal(cond.Direction, before.Histogram, now.Histogram)
+
+	case "rsi", "atr":
+		if cond.Type == "rsi" {
+			r.indicator.level, _ = indicators.RSI(closes, cond.Length)
+		} else {
+			r.indicator.level, _ = indicators.ATR(bars, cond.Length)
+		}
+		r.signal, r.direction = levelSignal(cond.Direction, r.indicator.level, cond.Value)
+
+	case "bollinger":
+		bands, _ := indicators.Bollinger(closes, cond.Length, cond.Deviations)
+		side := cond.Direction
+		if side == "outside" {
+			side = "above"
+			if quote.Price < bands.Middle {
+				side = "below"
+			}
+		}
+		r.indicator.band = bands.Upper
+		if side == "below" {
+			r.indicator.band = bands.Lower
+		}
+		r.signal, r.direction = levelSignal(side, quote.Price, r.indicator.band)
+	}
+
+	return r, true
+}
+
+// crossSignal is active when a difference between two lines changes sign
+// in the wanted direction ("up", "down" or "both") between the previous bar
+// and this one. The direction reported is the side the first line is on now.
+func crossSignal(want string, before, now float64) (signal, string) {
+	direction := "up"
+	if now < 0 {
+		direction = "down"
+	}
+
+	crossedUp := before <= 0 && now > 0
+	crossedDown := before >= 0 && now < 0
+	if (crossedUp && want != "down") || (crossedDown && want != "up") {
+		return signalActive, direction
+	}
+	return signalClear, direction
+}
+
+// levelSignal is active when value is at or beyond level on the given side
+// ("above" or "below")
+func levelSignal(side string, value, level float64) (signal, string) {
+	if side == "below" {
+		if value <= level {
+			return signalActive, "down"
+		}
+		return signalClear, "down"
+	}
+	if value >= level {
+		return signalActive, "up"
+	}
+	return signalClear, "up"
+}
+
+// points returns the ticker's recorded prices, with the ranges recorded for
+// backfilled and thinned records, followed by the current price
+func (e *Evaluator) points(ticker string, price float64) []indicators.Point {
+	records := e.state.PriceHistory[ticker]
+	points := make([]indicators.Point, 0, len(records)+1)
+	for _, r := range records {
+		points = append(points, indicators.Point{Time: r.Timestamp, Price: r.Price, High: r.High, Low: r.Low})
+	}
+	return append(points, indicators.Point{Time: time.Now(), Price: price})
+}
+
+func (e *Evaluator) formatIndicatorMessage(alert config.AlertConfig, cond config.ConditionConfig, price float64, r indicatorReading, direction string) string {
+	if cond.Message != "" {
+		return fmt.Sprintf("%s (%s, currently $%.2f)", cond.Message, direction, price)
+	}
+
+	name := alert.Name
+	if name == "" {
+		name = alert.Ticker
+	}
+
+	side := "above"
+	if direction == "down" {
+		side = "below"
+	}
+
+	switch cond.Type {
+	case "sma_cross", "ema_cross":
+		ma := strings.ToUpper(strings.TrimSuffix(cond.Type, "_cross"))
+		return fmt.Sprintf("%s %s(%d) crossed %s %s(%d) on %s bars ($%.2f vs $%.2f, currently $%.2f)",
+			name, ma, cond.Fast, side, ma, cond.Slow, cond.Interval, r.fast, r.slow, price)
+	case "macd":
+		return fmt.Sprintf("%s MACD(%d,%d,%d) crossed %s its signal line on %s bars (%.2f vs %.2f, currently $%.2f)",
+			name, cond.Fast, cond.Slow, cond.Signal, side, cond.Interval, r.macd.MACD, r.macd.Signal, price)
+	case "rsi":
+		return fmt.Sprintf("%s RSI(%d) is %s %.0f on %s bars (%.1f, currently $%.2f)",
+			name, cond.Length, side, cond.Value, cond.Interval, r.level, price)
+	case "atr":
+		return fmt.Sprintf("%s ATR(%d) is %s $%.2f on %s bars ($%.2f, currently $%.2f)",
+			name, cond.Length, side, cond.Value, cond.Interval, r.level, price)
+	case "bollinger":
+		band := "upper"
+		if side == "below" {
+			band = "lower"
+		}
+		return fmt.Sprintf("%s is %s the %s Bollinger Band(%d, %.1f) on %s bars (currently $%.2f vs $%.2f)",
+			name, side, band, cond.Length, cond.Deviations, cond.Interval, price, r.band)
+	}
+
+	return e.formatConditionMessage(alert, cond, price)
+}
@@ -0,0 +1,53 @@
+package alerts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/state"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+func TestATRUsesRecordedRanges(t *testing.T) {
+	// Daily candles that all close at 100 but trade 10 wide, as backfilled
+	// from Yahoo
+	var candles, closes []state.PriceRecord
+	for d := 5; d >= 1; d-- {
+		ts := time.Now().Add(-time.Duration(d) * 24 * time.Hour)
+		candles = append(candles, state.PriceRecord{Price: 100, High: 106, Low: 96, Timestamp: ts})
+		closes = append(closes, state.PriceRecord{Price: 100, Timestamp: ts})
+	}
+	cond := config.ConditionConfig{Type: "atr", Length: 3, Interval: "1d", Direction: "above", Value: 5}
+	alert := config.AlertConfig{Ticker: ticker, Conditions: []config.ConditionConfig{cond}}
+
+	tests := []struct {
+		name    string
+		history []state.PriceRecord
+		want    string // the ATR in the message, or "" if it shouldn't fire
+	}{
+		// Wilder's average of 10, 10, 10, 10 and today's 0
+		{"with ranges", candles, "$6.67"},
+		{"closes only", closes, ""},
+	}
+
+	for _, tt := range tests {
+		st, _ := newState(t)
+		st.Backfill(ticker, tt.history, tt.history[0].Timestamp)
+
+		triggered := NewEvaluator(st, false).Evaluate([]config.AlertConfig{alert}, map[string]*yahoo.Quote{ticker: {Price: 100}})
+		if tt.want == "" {
+			if len(triggered) != 0 {
+				t.Errorf("%s: fired: %s", tt.name, triggered[0].Message)
+			}
+			continue
+		}
+		if len(triggered) != 1 {
+			t.Fatalf("%s: %d alerts fired, want 1", tt.name, len(triggered))
+		}
+		if msg := triggered[0].Message; !strings.Contains(msg, "ATR(3) is above $5.00") || !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: message %q, want ATR %s", tt.name, msg, tt.want)
+		}
+	}
+}
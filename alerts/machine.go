@@ -0,0 +1,141 @@
+package alerts
+
+import (
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/period"
+	"github.com/vcavallo/asset-alerts/state"
+)
+
+// signal is a condition's reading on one check. The values are ordered so
+// that compound conditions can combine them with min (all) and max (any).
+type signal int
+
+const (
+	signalClear  signal = iota // the condition doesn't hold and is past any reset band
+	signalBand                 // the condition doesn't hold but is still inside its reset band
+	signalActive               // the condition holds
+)
+
+// previous is a condition's reading on the check before this one
+type previous struct {
+	known  bool // false if there was no earlier observation
+	active bool
+}
+
+// thresholdSignal reads an above/below condition at price
+func thresholdSignal(cond config.ConditionConfig, price float64) signal {
+	level, _ := cond.ResetLevel()
+
+	switch cond.Type {
+	case "above":
+		if price >= cond.Value {
+			return signalActive
+		}
+		if price > level {
+			return signalBand
+		}
+	case "below":
+		if price <= cond.Value {
+			return signalActive
+		}
+		if price < level {
+			return signalBand
+		}
+	}
+
+	return signalClear
+}
+
+// changeSignal reads a change condition from the size of the move
+func changeSignal(cond config.ConditionConfig, change float64) signal {
+	if change >= cond.Value {
+		return signalActive
+	}
+	return signalClear
+}
+
+// previous returns whether the condition held on the last check: for
+// above/below conditions from the last recorded price, otherwise as recorded
+// in state
+func (e *Evaluator) previous(ticker, key string, cond config.ConditionConfig) previous {
+	if cond.Type == "above" || cond.Type == "below" {
+		lastPrice, ok := e.state.GetLastPrice(ticker)
+		return previous{known: ok, active: ok && thresholdSignal(cond, lastPrice) == signalActive}
+	}
+
+	if !e.state.HasAlert(key) {
+		return previous{}
+	}
+	return previous{known: true, active: e.state.Condition(key).Active}
+}
+
+// triggers reports whether an armed condition that holds should fire, given
+// its trigger_on setting:
+//
+//	level:      always
+//	cross:      only on an observed transition from not holding to holding;
+//	            a condition that already holds when first evaluated waits for
+//	            the next crossing
+//	first_seen: like cross, but a new condition that already holds fires once
+func (e *Evaluator) triggers(cond config.ConditionConfig, seen bool, prev previous) bool {
+	switch cond.TriggerOn {
+	case "cross":
+		return prev.known && !prev.active
+	case "first_seen":
+		return !seen || (prev.known && !prev.active)
+	}
+	return true
+}
+
+// step advances the condition's state machine with this check's signal and
+// reports whether to notify, and whether the notification is a reminder:
+//
+//	armed     --active-->  triggered (notify, unless snoozed or trigger_on rules it out)
+//	triggered --active-->  triggered (remind every repeat_every until acknowledged)
+//	triggered --band-->    triggered
+//	triggered --clear-->   cooling while within cooldown of the last notification, else armed
+//	cooling   ----------> armed once the cooldown has elapsed, then handled as armed
+//
+// The transitions depend only on the current signal, so a condition that
+// clears between two checks always re-arms.
+func (e *Evaluator) step(key string, cond config.ConditionConfig, sig signal, prev previous) (fire, reminder bool) {
+	now := time.Now()
+	seen := e.state.HasAlert(key)
+	cs := e.state.Condition(key)
+	defer e.state.SetActive(key, sig == signalActive)
+	cooldown, _ := period.Parse(cond.Cooldown)
+
+	if cs.Phase == state.PhaseCooling && now.Sub(cs.LastFired) >= cooldown {
+		cs.Phase = state.PhaseArmed
+	}
+
+	switch cs.Phase {
+	case state.PhaseArmed:
+		if sig == signalActive && !e.state.IsSnoozed(key) && e.triggers(cond, seen, prev) {
+			e.state.SetPhase(key, state.PhaseTriggered, now)
+			e.state.RecordFired(key, now)
+			return true, false
+		}
+		e.state.SetPhase(key, state.PhaseArmed, now)
+
+	case state.PhaseTriggered:
+		switch sig {
+		case signalActive:
+			repeat, err := period.Parse(cond.RepeatEvery)
+			if err == nil && now.Sub(cs.LastFired) >= repeat && !e.state.IsAcknowledged(key) && !e.state.IsSnoozed(key) {
+				e.state.RecordFired(key, now)
+				return true, true
+			}
+		case signalClear:
+			if now.Sub(cs.LastFired) < cooldown {
+				e.state.SetPhase(key, state.PhaseCooling, now)
+			} else {
+				e.state.SetPhase(key, state.PhaseArmed, now)
+			}
+		}
+	}
+
+	return false, false
+}
@@ -0,0 +1,452 @@
+package alerts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/state"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+const ticker = "BTC-USD"
+
+// check is one run: optional changes to state beforehand, then an
+// evaluation at price and its expected outcome
+type check struct {
+	price    float64
+	before   func(st *state.State, key string)
+	reload   bool // save and reload state first, as separate runs do
+	fires    bool
+	reminder bool
+	phase    state.Phase
+}
+
+// age moves the condition's last notification back by d, as if d had passed
+func age(d time.Duration) func(*state.State, string) {
+	return func(st *state.State, key string) {
+		cs := st.Conditions[key]
+		cs.LastFired = cs.LastFired.Add(-d)
+		st.Conditions[key] = cs
+	}
+}
+
+func snooze(d time.Duration) func(*state.State, string) {
+	return func(st *state.State, key string) { st.Snooze(key, time.Now().Add(d)) }
+}
+
+func unsnooze(st *state.State, key string) { st.Snoozed[key] = time.Now().Add(-time.Second) }
+
+func ack(st *state.State, key string) { st.Acknowledge(key) }
+
+// run evaluates cond through checks, recording each price afterwards as
+// the check command does, and returns the final state
+func run(t *testing.T, st *state.State, path string, cond config.ConditionConfig, checks []check) *state.State {
+	t.Helper()
+	alert := config.AlertConfig{Ticker: ticker, Conditions: []config.ConditionConfig{cond}}
+	key := ConditionKey(ticker, cond)
+
+	for i, c := range checks {
+		if c.reload {
+			if err := st.Save(); err != nil {
+				t.Fatalf("check %d: saving state: %v", i, err)
+			}
+			loaded, err := state.Load(path)
+			if err != nil {
+				t.Fatalf("check %d: loading state: %v", i, err)
+			}
+			st = loaded
+		}
+		if c.before != nil {
+			c.before(st, key)
+		}
+
+		triggered := NewEvaluator(st, false).Evaluate([]config.AlertConfig{alert}, map[string]*yahoo.Quote{ticker: {Price: c.price}})
+		st.UpdatePrice(ticker, c.price, 0, 7*24*time.Hour, time.Hour)
+
+		if fired := len(triggered) == 1; fired != c.fires {
+			t.Fatalf("check %d at %.0f: fired = %v, want %v", i, c.price, fired, c.fires)
+		}
+		if c.fires && triggered[0].Reminder != c.reminder {
+			t.Errorf("check %d at %.0f: reminder = %v, want %v", i, c.price, triggered[0].Reminder, c.reminder)
+		}
+		if phase := st.Condition(key).Phase; phase != c.phase {
+			t.Errorf("check %d at %.0f: phase = %s, want %s", i, c.price, phase, c.phase)
+		}
+	}
+	return st
+}
+
+func newState(t *testing.T) (*state.State, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("loading state: %v", err)
+	}
+	return st, path
+}
+
+const (
+	armed     = state.PhaseArmed
+	triggered = state.PhaseTriggered
+	cooling   = state.PhaseCooling
+)
+
+func TestStateMachine(t *testing.T) {
+	above := config.ConditionConfig{Type: "above", Value: 100, TriggerOn: "level"}
+	with := func(f func(*config.ConditionConfig)) config.ConditionConfig {
+		c := above
+		f(&c)
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		cond   config.ConditionConfig
+		checks []check
+	}{
+		{
+			name: "fires once per crossing",
+			cond: above,
+			checks: []check{
+				{price: 90, phase: armed},
+				{price: 105, fires: true, phase: triggered},
+				{price: 110, phase: triggered},
+				{price: 95, phase: armed},
+				{price: 101, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "re-cross within cooldown waits for it",
+			cond: with(func(c *config.ConditionConfig) { c.Cooldown = "1h" }),
+			checks: []check{
+				{price: 90, phase: armed},
+				{price: 105, fires: true, phase: triggered},
+				{price: 95, phase: cooling},
+				{price: 105, phase: cooling},
+				{price: 95, phase: cooling},
+				{price: 105, before: age(2 * time.Hour), fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "cooldown elapsed before clearing re-arms directly",
+			cond: with(func(c *config.ConditionConfig) { c.Cooldown = "1h" }),
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 95, before: age(2 * time.Hour), phase: armed},
+				{price: 105, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "cooling re-arms once the cooldown ends while clear",
+			cond: with(func(c *config.ConditionConfig) { c.Cooldown = "1h" }),
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 95, phase: cooling},
+				{price: 95, before: age(2 * time.Hour), phase: armed},
+				{price: 105, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "reset band holds the trigger until the price moves back",
+			cond: with(func(c *config.ConditionConfig) { c.ResetBand = "5" }),
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 97, phase: triggered},
+				{price: 102, phase: triggered},
+				{price: 96, phase: triggered},
+				{price: 94, phase: armed},
+				{price: 101, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "percentage reset band",
+			cond: with(func(c *config.ConditionConfig) { c.ResetBand = "2%" }),
+			checks: []check{
+				{price: 100, fires: true, phase: triggered},
+				{price: 98.5, phase: triggered},
+				{price: 100.5, phase: triggered},
+				{price: 97.9, phase: armed},
+				{price: 100, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "cross-back between runs re-arms",
+			cond: above,
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 95, reload: true, phase: armed},
+				{price: 105, reload: true, fires: true, phase: triggered},
+				{price: 106, reload: true, phase: triggered},
+			},
+		},
+		{
+			name: "triggered state survives a restart",
+			cond: above,
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 105, reload: true, phase: triggered},
+			},
+		},
+		{
+			name: "level fires when first seen holding",
+			cond: above,
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "cross waits for an observed crossing",
+			cond: with(func(c *config.ConditionConfig) { c.TriggerOn = "cross" }),
+			checks: []check{
+				{price: 105, phase: armed},
+				{price: 106, phase: armed},
+				{price: 95, phase: armed},
+				{price: 105, fires: true, phase: triggered},
+				{price: 95, phase: armed},
+				{price: 105, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "first_seen fires once when first seen holding",
+			cond: with(func(c *config.ConditionConfig) { c.TriggerOn = "first_seen" }),
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 95, phase: armed},
+				{price: 105, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "first_seen doesn't fire again after a snooze ends",
+			cond: with(func(c *config.ConditionConfig) { c.TriggerOn = "first_seen" }),
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 105, before: snooze(time.Hour), phase: armed},
+				{price: 105, before: unsnooze, phase: armed},
+				{price: 95, phase: armed},
+				{price: 105, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "snooze while triggered fires again after it if still holding",
+			cond: above,
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 106, before: snooze(time.Hour), phase: armed},
+				{price: 107, phase: armed},
+				{price: 108, before: unsnooze, fires: true, phase: triggered},
+			},
+		},
+		{
+			name: "snooze suppresses reminders",
+			cond: with(func(c *config.ConditionConfig) { c.RepeatEvery = "1h" }),
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 105, before: func(st *state.State, key string) {
+					age(2*time.Hour)(st, key)
+					st.Snooze(key, time.Now().Add(time.Hour))
+				}, phase: armed},
+			},
+		},
+		{
+			name: "reminders repeat until acknowledged",
+			cond: with(func(c *config.ConditionConfig) { c.RepeatEvery = "1h" }),
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 105, phase: triggered},
+				{price: 105, before: age(2 * time.Hour), fires: true, reminder: true, phase: triggered},
+				{price: 105, phase: triggered},
+				{price: 105, before: func(st *state.State, key string) {
+					age(2*time.Hour)(st, key)
+					ack(st, key)
+				}, phase: triggered},
+				{price: 95, phase: armed},
+				{price: 105, fires: true, phase: triggered},
+				{price: 105, before: age(2 * time.Hour), fires: true, reminder: true, phase: triggered},
+			},
+		},
+		{
+			name: "ack while triggered is cleared on re-arm",
+			cond: above,
+			checks: []check{
+				{price: 105, fires: true, phase: triggered},
+				{price: 105, before: ack, phase: triggered},
+				{price: 95, phase: armed},
+				{price: 105, fires: true, phase: triggered},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, path := newState(t)
+			run(t, st, path, tt.cond, tt.checks)
+		})
+	}
+}
+
+func TestTriggerOnWithKnownPreviousPrice(t *testing.T) {
+	// The ticker's price was recorded before the condition was added
+	tests := []struct {
+		triggerOn string
+		previous  float64
+		fires     bool
+	}{
+		{"level", 105, true},
+		{"cross", 105, false},
+		{"cross", 95, true},
+		{"first_seen", 105, true},
+		{"first_seen", 95, true},
+	}
+
+	for _, tt := range tests {
+		st, path := newState(t)
+		st.UpdatePrice(ticker, tt.previous, 0, time.Hour, time.Hour)
+		cond := config.ConditionConfig{Type: "above", Value: 100, TriggerOn: tt.triggerOn}
+
+		phase := armed
+		if tt.fires {
+			phase = triggered
+		}
+		t.Run(tt.triggerOn, func(t *testing.T) {
+			run(t, st, path, cond, []check{{price: 105, fires: tt.fires, phase: phase}})
+		})
+	}
+}
+
+func TestLegacyStateMigration(t *testing.T) {
+	cond := config.ConditionConfig{Type: "above", Value: 100, TriggerOn: "level"}
+	key := ConditionKey(ticker, cond)
+	other := state.AlertKey(ticker, "below", 50)
+	kept := state.AlertKey(ticker, "below", 60)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	legacy := `{
+  "prices": {"BTC-USD": {"price": 105, "timestamp": "2025-01-01T00:00:00Z"}},
+  "conditions": {"` + kept + `": {"phase": "cooling"}},
+  "triggered_alerts": {"` + key + `": true, "` + other + `": false, "` + kept + `": true}
+}`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("loading legacy state: %v", err)
+	}
+
+	want := map[string]state.Phase{key: triggered, other: armed, kept: cooling}
+	for k, phase := range want {
+		if got := st.Condition(k).Phase; got != phase {
+			t.Errorf("%s: phase = %s, want %s", k, got, phase)
+		}
+	}
+	if st.TriggeredAlerts != nil {
+		t.Errorf("legacy flags kept: %v", st.TriggeredAlerts)
+	}
+
+	// The migrated alert doesn't fire again while it holds, re-arms when it
+	// clears, and the legacy flags aren't written back
+	st = run(t, st, path, cond, []check{
+		{price: 106, phase: triggered},
+		{price: 95, reload: true, phase: armed},
+		{price: 105, fires: true, phase: triggered},
+	})
+	if err := st.Save(); err != nil {
+		t.Fatalf("saving state: %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "triggered_alerts") {
+		t.Errorf("saved state still has triggered_alerts:\n%s", data)
+	}
+}
+
+func TestSameValueConditionsOnDifferentPeriods(t *testing.T) {
+	st, _ := newState(t)
+	// Up 6% on the day, but under 3% in the last hour
+	st.Backfill(ticker, []state.PriceRecord{
+		{Price: 100, Timestamp: time.Now().Add(-25 * time.Hour)},
+		{Price: 103, Timestamp: time.Now().Add(-2 * time.Hour)},
+	}, time.Now().Add(-25*time.Hour))
+
+	hourly := config.ConditionConfig{Type: "percent_change", Value: 5, Period: "1h"}
+	daily := config.ConditionConfig{Type: "percent_change", Value: 5, Period: "24h"}
+	alert := config.AlertConfig{Ticker: ticker, Conditions: []config.ConditionConfig{daily, hourly}}
+
+	hourlyKey, dailyKey := ConditionKey(ticker, hourly), ConditionKey(ticker, daily)
+	if hourlyKey == dailyKey {
+		t.Fatalf("both conditions are keyed %s", hourlyKey)
+	}
+
+	// The daily condition fires once and stays triggered; the hourly one
+	// staying clear doesn't re-arm it
+	for i := 0; i < 3; i++ {
+		triggered := NewEvaluator(st, false).Evaluate([]config.AlertConfig{alert}, map[string]*yahoo.Quote{ticker: {Price: 106}})
+		if want := map[bool]int{true: 1, false: 0}[i == 0]; len(triggered) != want {
+			t.Fatalf("check %d: %d alerts fired, want %d", i, len(triggered), want)
+		}
+		if i == 0 && triggered[0].Key != dailyKey {
+			t.Errorf("fired %s, want %s", triggered[0].Key, dailyKey)
+		}
+	}
+	if got := st.Condition(dailyKey).Phase; got != triggered {
+		t.Errorf("daily phase = %s, want triggered", got)
+	}
+	if got := st.Condition(hourlyKey).Phase; got != armed {
+		t.Errorf("hourly phase = %s, want armed", got)
+	}
+}
+
+func TestConditionKeys(t *testing.T) {
+	tests := []struct {
+		cond config.ConditionConfig
+		want string
+	}{
+		{config.ConditionConfig{Type: "above", Value: 100000, TriggerOn: "level"}, "BTC-USD:above:100000.00"},
+		{config.ConditionConfig{Type: "above", Value: 100000, TriggerOn: "cross"}, "BTC-USD:above:100000.00:cross::"},
+		{config.ConditionConfig{Type: "below", Value: 90000, ResetBand: "2%"}, "BTC-USD:below:90000.00:level:2%:"},
+		{config.ConditionConfig{Type: "percent_change", Value: 5, Period: "24h", Cooldown: "1h"}, "BTC-USD:percent_change:5.00:24h:level::1h"},
+		{config.ConditionConfig{Type: "rsi", Length: 14, Interval: "1d", Direction: "below", Value: 30}, "BTC-USD:rsi:14:1d:below:30.00"},
+	}
+	for _, tt := range tests {
+		if got := ConditionKey(ticker, tt.cond); got != tt.want {
+			t.Errorf("ConditionKey(%+v) = %q, want %q", tt.cond, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyKeyMigration(t *testing.T) {
+	st, _ := newState(t)
+	hourly := config.ConditionConfig{Type: "percent_change", Value: 5, Period: "1h", TriggerOn: "level"}
+	daily := config.ConditionConfig{Type: "percent_change", Value: 5, Period: "24h", TriggerOn: "level"}
+	above := config.ConditionConfig{Type: "above", Value: 100, TriggerOn: "level"}
+	alertCfgs := []config.AlertConfig{{Ticker: ticker, Conditions: []config.ConditionConfig{hourly, daily, above}}}
+
+	// Older versions keyed both change conditions the same
+	legacy := state.AlertKey(ticker, "percent_change", 5)
+	st.SetPhase(legacy, triggered, time.Now())
+	st.Acknowledge(legacy)
+	st.SetPhase(ConditionKey(ticker, above), cooling, time.Now())
+
+	st.MigrateKeys(LegacyKeys(alertCfgs))
+
+	for _, cond := range []config.ConditionConfig{hourly, daily} {
+		key := ConditionKey(ticker, cond)
+		if got := st.Condition(key).Phase; got != triggered {
+			t.Errorf("%s: phase = %s, want triggered", key, got)
+		}
+		if !st.IsAcknowledged(key) {
+			t.Errorf("%s: acknowledgement not migrated", key)
+		}
+	}
+	if _, ok := st.Conditions[legacy]; ok || st.IsAcknowledged(legacy) {
+		t.Errorf("legacy key %s kept", legacy)
+	}
+	// Keys that didn't change are left alone
+	if got := st.Condition(ConditionKey(ticker, above)).Phase; got != cooling {
+		t.Errorf("above: phase = %s, want cooling", got)
+	}
+}
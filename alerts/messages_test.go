@@ -0,0 +1,52 @@
+package alerts
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/state"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// evaluate runs one check of cond at price and returns the alert's message,
+// or "" if it didn't fire
+func evaluate(st *state.State, cond config.ConditionConfig, price float64) string {
+	alert := config.AlertConfig{Ticker: ticker, Conditions: []config.ConditionConfig{cond}}
+	triggered := NewEvaluator(st, false).Evaluate([]config.AlertConfig{alert}, map[string]*yahoo.Quote{ticker: {Price: price}})
+	st.UpdatePrice(ticker, price, 0, 7*24*time.Hour, time.Hour)
+	if len(triggered) == 0 {
+		return ""
+	}
+	return triggered[0].Message
+}
+
+func TestTrailingStopMessage(t *testing.T) {
+	st, _ := newState(t)
+	cond := config.ConditionConfig{Type: "trailing_stop", Trail: "10%", Reset: "recover"}
+
+	for _, price := range []float64{100, 120} {
+		if msg := evaluate(st, cond, price); msg != "" {
+			t.Fatalf("fired at %.0f: %s", price, msg)
+		}
+	}
+
+	msg := evaluate(st, cond, 105)
+	for _, want := range []string{"trailing stop at $108.00", "down 12.5% ($15.00)", "high of $120.00", "currently $105.00"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q doesn't contain %q", msg, want)
+		}
+	}
+}
+
+func TestRecordMessage(t *testing.T) {
+	st, _ := newState(t)
+	st.UpdateExtremes(ticker, 90, 100, 50)
+
+	msg := evaluate(st, config.ConditionConfig{Type: "new_52w_high"}, 110)
+	want := "hit a new 52-week high of $110.00, 10.00% ($10.00) above the previous high of $100.00"
+	if !strings.Contains(msg, want) {
+		t.Errorf("message %q doesn't contain %q", msg, want)
+	}
+}
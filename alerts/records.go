@@ -0,0 +1,137 @@
+package alerts
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// year is the span of 52-week records
+const year = 52 * 7 * 24 * time.Hour
+
+// recordReading is the record a record condition compared the price with
+type recordReading struct {
+	previous float64 // the record before this check
+	beyond   float64 // how far the price is past it, in percent, negative when short of it
+}
+
+// readRecord compares the price with the ticker's previous 52-week or
+// all-time record, the more extreme of Yahoo's figure at the last check and
+// the prices recorded in state. The current quote's own 52-week figures are
+// only used by near_52w_high, since they already include today's prices. It
+// reports false until a record is known: for the 52-week conditions, until
+// Yahoo has reported a 52-week figure at a previous check or the recorded
+// prices cover a year, since a shorter history alone would make any recent
+// high look like a 52-week one.
+func (e *Evaluator) readRecord(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) (reading, bool) {
+	x := e.state.Extremes[alert.Ticker]
+	start, recorded := e.state.HistoryStart(alert.Ticker)
+	coversYear := recorded && !start.After(time.Now().Add(-year))
+
+	var record float64
+	switch cond.Type {
+	case "new_52w_high", "near_52w_high":
+		known := x.High52w > 0 || coversYear
+		if cond.Type == "near_52w_high" {
+			known = known || quote.High52w > 0
+		}
+		if !known {
+			return reading{}, false
+		}
+		high, _ := e.historyRange(alert.Ticker, year)
+		record = max(x.High52w, high)
+		if cond.Type == "near_52w_high" {
+			record = max(record, quote.High52w)
+		}
+
+	case "new_52w_low":
+		if x.Low52w == 0 && !coversYear {
+			return reading{}, false
+		}
+		_, low := e.historyRange(alert.Ticker, year)
+		record = low
+		if x.Low52w > 0 && (record == 0 || x.Low52w < record) {
+			record = x.Low52w
+		}
+
+	case "new_all_time_high":
+		if x.AllTimeHigh == 0 {
+			return reading{}, false
+		}
+		high, _ := e.historyRange(alert.Ticker, 0)
+		record = max(x.AllTimeHigh, high)
+	}
+	if record == 0 {
+		return reading{}, false
+	}
+
+	r := reading{
+		signal:    signalClear,
+		reference: record,
+		direction: "up",
+		record:    recordReading{previous: record, beyond: (quote.Price - record) / record * 100},
+	}
+	switch cond.Type {
+	case "new_52w_high", "new_all_time_high":
+		if quote.Price > record {
+			r.signal = signalActive
+		}
+	case "new_52w_low":
+		r.direction = "down"
+		if quote.Price < record {
+			r.signal = signalActive
+		}
+	case "near_52w_high":
+		if quote.Price >= record*(1-cond.Value/100) {
+			r.signal = signalActive
+		}
+	}
+	return r, true
+}
+
+// historyRange returns the highest and lowest recorded prices for the ticker
+// within the last span, or all recorded prices if span is 0. Both are 0 if
+// there are none.
+func (e *Evaluator) historyRange(ticker string, span time.Duration) (high, low float64) {
+	cutoff := time.Now().Add(-span)
+	for _, r := range e.state.PriceHistory[ticker] {
+		if span > 0 && r.Timestamp.Before(cutoff) {
+			continue
+		}
+		high = max(high, r.Price)
+		if low == 0 || r.Price < low {
+			low = r.Price
+		}
+	}
+	return high, low
+}
+
+func (e *Evaluator) formatRecordMessage(alert config.AlertConfig, cond config.ConditionConfig, price float64, r recordReading) string {
+	if cond.Message != "" {
+		return fmt.Sprintf("%s (previous record $%.2f, currently $%.2f)", cond.Message, r.previous, price)
+	}
+
+	name := alert.Name
+	if name == "" {
+		name = alert.Ticker
+	}
+
+	beyond := fmt.Sprintf("%.2f%% ($%.2f)", math.Abs(r.beyond), math.Abs(price-r.previous))
+
+	switch cond.Type {
+	case "new_52w_high":
+		return fmt.Sprintf("%s hit a new 52-week high of $%.2f, %s above the previous high of $%.2f", name, price, beyond, r.previous)
+	case "new_52w_low":
+		return fmt.Sprintf("%s hit a new 52-week low of $%.2f, %s below the previous low of $%.2f", name, price, beyond, r.previous)
+	case "new_all_time_high":
+		return fmt.Sprintf("%s hit a new all-time high of $%.2f, %s above the previous record of $%.2f", name, price, beyond, r.previous)
+	}
+
+	if price >= r.previous {
+		return fmt.Sprintf("%s is at its 52-week high of $%.2f (currently $%.2f)", name, r.previous, price)
+	}
+	return fmt.Sprintf("%s is within %.1f%% of its 52-week high: %s below $%.2f (currently $%.2f)", name, cond.Value, beyond, r.previous, price)
+}
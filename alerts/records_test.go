@@ -0,0 +1,80 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/state"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+func TestRecordsWaitForAYearOrYahoo(t *testing.T) {
+	// A few days of history between 80 and 100, far inside Yahoo's 52-week
+	// range of 40 to 150
+	days := []state.PriceRecord{
+		{Price: 100, Timestamp: time.Now().Add(-72 * time.Hour)},
+		{Price: 80, Timestamp: time.Now().Add(-48 * time.Hour)},
+		{Price: 90, Timestamp: time.Now().Add(-24 * time.Hour)},
+	}
+
+	tests := []struct {
+		cond     string
+		price    float64
+		extremes bool // Yahoo's range is known from a previous check
+		wantOK   bool
+		fires    bool
+	}{
+		// The short history alone isn't a 52-week record, even though the
+		// current quote reports one
+		{cond: "new_52w_high", price: 110},
+		{cond: "new_52w_low", price: 70},
+		{cond: "new_52w_high", price: 110, extremes: true, wantOK: true},
+		{cond: "new_52w_high", price: 160, extremes: true, wantOK: true, fires: true},
+		{cond: "new_52w_low", price: 70, extremes: true, wantOK: true},
+		{cond: "new_52w_low", price: 30, extremes: true, wantOK: true, fires: true},
+		// near_52w_high can use the current quote's range, which already
+		// includes today
+		{cond: "near_52w_high", price: 110, wantOK: true},
+		{cond: "near_52w_high", price: 145, wantOK: true, fires: true},
+	}
+
+	for _, tt := range tests {
+		st, _ := newState(t)
+		st.Backfill(ticker, days, days[0].Timestamp)
+		if tt.extremes {
+			st.UpdateExtremes(ticker, 90, 150, 40)
+		}
+
+		cond := config.ConditionConfig{Type: tt.cond}
+		if tt.cond == "near_52w_high" {
+			cond.Value = 5
+		}
+		quote := &yahoo.Quote{Price: tt.price, High52w: max(150, tt.price), Low52w: min(40, tt.price)}
+
+		r, ok := NewEvaluator(st, false).readRecord(config.AlertConfig{Ticker: ticker}, cond, quote)
+		if ok != tt.wantOK {
+			t.Errorf("%s at %.0f (extremes %v): ok = %v, want %v", tt.cond, tt.price, tt.extremes, ok, tt.wantOK)
+			continue
+		}
+		if fires := r.signal == signalActive; ok && fires != tt.fires {
+			t.Errorf("%s at %.0f (extremes %v): fires = %v, want %v", tt.cond, tt.price, tt.extremes, fires, tt.fires)
+		}
+	}
+}
+
+func TestRecordsFromAYearOfHistory(t *testing.T) {
+	st, _ := newState(t)
+	st.Backfill(ticker, []state.PriceRecord{
+		{Price: 120, Timestamp: time.Now().Add(-year - 24*time.Hour)},
+		{Price: 100, Timestamp: time.Now().Add(-200 * 24 * time.Hour)},
+		{Price: 80, Timestamp: time.Now().Add(-24 * time.Hour)},
+	}, time.Now().Add(-year-24*time.Hour))
+
+	// Without Yahoo's figures, a year of history is enough, and prices
+	// older than a year don't count
+	r, ok := NewEvaluator(st, false).readRecord(config.AlertConfig{Ticker: ticker}, config.ConditionConfig{Type: "new_52w_high"}, &yahoo.Quote{Price: 110})
+	if !ok || r.signal != signalActive {
+		t.Errorf("new_52w_high at 110 over a year topping out at 100: ok = %v, signal = %v; want it to fire", ok, r.signal)
+	}
+}
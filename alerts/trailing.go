@@ -0,0 +1,86 @@
+package alerts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/state"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// trailingReading is where a trailing stop or drawdown stands against its
+// high-water mark
+type trailingReading struct {
+	high  float64   // the high-water mark
+	since time.Time // when the high-water mark started
+	stop  float64   // the trailing stop's level below the high
+	drop  float64   // how far the price is below the high, in percent
+}
+
+// readTrailing compares the price with the stop level below the condition's
+// high-water mark, raising the mark first. Tracking starts on the first check
+// at or above the activation price. When the stop is hit, reset decides what
+// happens next:
+//
+//	recover:  the condition re-arms once the price is back above the stop
+//	new_high: the mark restarts from the current price, so the next alert
+//	          needs a fresh fall from a new peak
+//	never:    the condition stays triggered for good
+func (e *Evaluator) readTrailing(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) (reading, bool) {
+	key := alert.Ticker + ":" + cond.Canonical()
+	now := time.Now()
+
+	mark, ok := e.state.HighWaterMark(key)
+	if !ok {
+		if quote.Price < cond.Activation {
+			return reading{signal: signalClear, direction: "down"}, true
+		}
+		mark = state.HighWaterMark{High: quote.Price, Since: now}
+	}
+	mark.High = max(mark.High, quote.Price)
+
+	r := reading{
+		signal:    signalClear,
+		reference: mark.High,
+		direction: "down",
+		trailing: trailingReading{
+			high:  mark.High,
+			since: mark.Since,
+			stop:  cond.StopLevel(mark.High),
+			drop:  (mark.High - quote.Price) / mark.High * 100,
+		},
+	}
+
+	if mark.Stopped || quote.Price <= r.trailing.stop {
+		r.signal = signalActive
+		switch cond.Reset {
+		case "new_high":
+			mark = state.HighWaterMark{High: quote.Price, Since: now}
+		case "never":
+			mark.Stopped = true
+		}
+	}
+
+	e.state.SetHighWaterMark(key, mark)
+	return r, true
+}
+
+func (e *Evaluator) formatTrailingMessage(alert config.AlertConfig, cond config.ConditionConfig, price float64, r trailingReading) string {
+	if cond.Message != "" {
+		return fmt.Sprintf("%s (down %.1f%% from $%.2f, currently $%.2f)", cond.Message, r.drop, r.high, price)
+	}
+
+	name := alert.Name
+	if name == "" {
+		name = alert.Ticker
+	}
+
+	since := r.since.Format("Jan 2")
+	if cond.Type == "trailing_stop" {
+		return fmt.Sprintf("%s hit its trailing stop at $%.2f: down %.1f%% ($%.2f) from its high of $%.2f since %s (currently $%.2f)",
+			name, r.stop, r.drop, r.high-price, r.high, since, price)
+	}
+	return fmt.Sprintf("%s is down %.1f%% ($%.2f) from its high of $%.2f since %s (currently $%.2f)",
+		name, r.drop, r.high-price, r.high, since, price)
+}
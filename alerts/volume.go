@@ -0,0 +1,154 @@
+package alerts
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/period"
+	"github.com/vcavallo/asset-alerts/state"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// volumeReading is the volume a volume condition compared with its average
+type volumeReading struct {
+	volume   float64 // today's volume, or the volume traded over the period
+	average  float64 // the average it is compared with
+	multiple float64 // volume as a multiple of the average
+}
+
+// readVolume compares volume with its average. Recorded volumes are running
+// totals for the UTC day. It reports false while there isn't enough volume
+// history, or when Yahoo doesn't report volume for the ticker.
+func (e *Evaluator) readVolume(alert config.AlertConfig, cond config.ConditionConfig, quote *yahoo.Quote) (reading, bool) {
+	if quote.Volume == 0 {
+		return reading{}, false
+	}
+
+	var volume, average float64
+	var ok bool
+	if cond.Type == "volume_spike" {
+		volume = float64(quote.Volume)
+		average, ok = e.averageDailyVolume(alert.Ticker, cond.Length)
+	} else {
+		window, _ := period.Parse(cond.Period)
+		volume, average, ok = e.recentVolume(alert.Ticker, quote.Volume, window, cond.Length)
+	}
+	if !ok || average == 0 {
+		return reading{}, false
+	}
+
+	lastPrice, _ := e.state.GetLastPrice(alert.Ticker)
+	r := reading{
+		signal:    signalClear,
+		reference: lastPrice,
+		direction: "up",
+		volume:    volumeReading{volume: volume, average: average, multiple: volume / average},
+	}
+	if r.volume.multiple >= cond.Value {
+		r.signal = signalActive
+	}
+	return r, true
+}
+
+// averageDailyVolume returns the average volume of the last n UTC days
+// before today, taking each day's last recorded running total as its volume
+func (e *Evaluator) averageDailyVolume(ticker string, n int) (float64, bool) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	var daily []int64
+	var day time.Time
+	for _, r := range e.state.PriceHistory[ticker] {
+		d := r.Timestamp.UTC().Truncate(24 * time.Hour)
+		if r.Volume == 0 || !d.Before(today) {
+			continue
+		}
+		if len(daily) > 0 && d.Equal(day) {
+			daily[len(daily)-1] = r.Volume
+			continue
+		}
+		day = d
+		daily = append(daily, r.Volume)
+	}
+
+	if len(daily) < n {
+		return 0, false
+	}
+	var sum int64
+	for _, v := range daily[len(daily)-n:] {
+		sum += v
+	}
+	return float64(sum) / float64(n), true
+}
+
+// recentVolume returns the volume traded over the last period and the
+// average volume traded per period over the last days. The average only
+// counts time in which volume was traded, so that market closures don't
+// dilute it.
+func (e *Evaluator) recentVolume(ticker string, current int64, period time.Duration, days int) (float64, float64, bool) {
+	now := time.Now()
+	since := now.Add(-time.Duration(days) * 24 * time.Hour)
+	history := e.state.PriceHistory[ticker]
+	if start, ok := e.state.HistoryStart(ticker); !ok || start.After(since) {
+		return 0, 0, false
+	}
+
+	// The running total at the start of the period, from the same UTC day
+	var ref *state.PriceRecord
+	for i := range history {
+		if history[i].Timestamp.After(now.Add(-period)) {
+			break
+		}
+		ref = &history[i]
+	}
+	sameDay := func(a, b time.Time) bool {
+		return a.UTC().Truncate(24 * time.Hour).Equal(b.UTC().Truncate(24 * time.Hour))
+	}
+	if ref == nil || ref.Volume == 0 || ref.Volume > current || !sameDay(ref.Timestamp, now) {
+		return 0, 0, false
+	}
+	volume := float64(current-ref.Volume) / float64(now.Sub(ref.Timestamp)) * float64(period)
+
+	var traded int64
+	var elapsed time.Duration
+	for i := 1; i < len(history); i++ {
+		prev, r := history[i-1], history[i]
+		if prev.Timestamp.After(since) && !r.Timestamp.After(ref.Timestamp) && r.Volume > prev.Volume && prev.Volume > 0 && sameDay(prev.Timestamp, r.Timestamp) {
+			traded += r.Volume - prev.Volume
+			elapsed += r.Timestamp.Sub(prev.Timestamp)
+		}
+	}
+	if elapsed == 0 {
+		return 0, 0, false
+	}
+
+	return volume, float64(traded) / float64(elapsed) * float64(period), true
+}
+
+func (e *Evaluator) formatVolumeMessage(alert config.AlertConfig, cond config.ConditionConfig, price float64, r volumeReading) string {
+	if cond.Message != "" {
+		return fmt.Sprintf("%s (%.1f× average volume, currently $%.2f)", cond.Message, r.multiple, price)
+	}
+
+	name := alert.Name
+	if name == "" {
+		name = alert.Ticker
+	}
+
+	if cond.Type == "volume_spike" {
+		return fmt.Sprintf("%s volume today is %.1f× its %d-day average (%s vs %s, currently $%.2f)",
+			name, r.multiple, cond.Length, formatVolume(int64(r.volume)), formatVolume(int64(r.average)), price)
+	}
+	return fmt.Sprintf("%s traded %.1f× its usual volume in the last %s (%s vs %s, currently $%.2f)",
+		name, r.multiple, cond.Period, formatVolume(int64(r.volume)), formatVolume(int64(r.average)), price)
+}
+
+// formatVolume formats a volume with thousands separators, e.g. "1,234,567"
+func formatVolume(v int64) string {
+	s := strconv.FormatInt(v, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,264 @@
+package alerts
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/state"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// session returns hourly records for the UTC day starting at day, from hour
+// from to hour to, with perHour traded in each hour before a record
+func session(day time.Time, from, to int, perHour int64) []state.PriceRecord {
+	var records []state.PriceRecord
+	for h := from; h <= to; h++ {
+		records = append(records, state.PriceRecord{
+			Price:     100,
+			Volume:    perHour * int64(h-from+1),
+			Timestamp: day.Add(time.Duration(h) * time.Hour),
+		})
+	}
+	return records
+}
+
+// join concatenates records
+func join(parts ...[]state.PriceRecord) []state.PriceRecord {
+	var all []state.PriceRecord
+	for _, p := range parts {
+		all = append(all, p...)
+	}
+	return all
+}
+
+// volumeState returns a state with history for the test ticker
+func volumeState(t *testing.T, history []state.PriceRecord) *state.State {
+	t.Helper()
+	st, _ := newState(t)
+	if len(history) > 0 {
+		st.Backfill(ticker, history, history[0].Timestamp)
+	}
+	return st
+}
+
+func TestAverageDailyVolume(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	day := func(n int) time.Time { return today.Add(-time.Duration(n) * 24 * time.Hour) }
+
+	tests := []struct {
+		name    string
+		history []state.PriceRecord
+		n       int
+		want    float64
+		wantOK  bool
+	}{
+		{
+			name:    "last total of each day",
+			history: join(session(day(3), 14, 20, 1000), session(day(2), 14, 20, 2000), session(day(1), 14, 20, 3000)),
+			n:       3, want: (7000 + 14000 + 21000) / 3.0, wantOK: true,
+		},
+		{
+			name:    "last n days only",
+			history: join(session(day(3), 14, 20, 1000), session(day(2), 14, 20, 2000), session(day(1), 14, 20, 3000)),
+			n:       2, want: (14000 + 21000) / 2.0, wantOK: true,
+		},
+		{
+			name:    "today's partial volume is left out",
+			history: join(session(day(2), 14, 20, 1000), session(day(1), 14, 20, 1000), session(today, 0, 0, 50000)),
+			n:       2, want: 7000, wantOK: true,
+		},
+		{
+			// A day whose checks stopped early counts the volume seen by then
+			name:    "partial day",
+			history: join(session(day(2), 14, 20, 1000), session(day(1), 14, 16, 1000)),
+			n:       2, want: (7000 + 3000) / 2.0, wantOK: true,
+		},
+		{
+			// Days without records, like weekends, are skipped rather than
+			// counted as zero
+			name:    "missing days",
+			history: join(session(day(5), 14, 20, 1000), session(day(4), 14, 20, 1000), session(day(1), 14, 20, 1000)),
+			n:       3, want: 7000, wantOK: true,
+		},
+		{
+			// Around-the-clock trading: the running total resets at midnight
+			name:    "reset across midnight",
+			history: join(session(day(2), 0, 23, 1000), session(day(1), 0, 23, 500)),
+			n:       2, want: (24000 + 12000) / 2.0, wantOK: true,
+		},
+		{
+			name: "records without volume are ignored",
+			history: join(session(day(2), 14, 20, 1000), session(day(1), 14, 20, 1000),
+				[]state.PriceRecord{{Price: 100, Timestamp: day(1).Add(22 * time.Hour)}}),
+			n: 2, want: 7000, wantOK: true,
+		},
+		{
+			name:    "too few days",
+			history: join(session(day(2), 14, 20, 1000), session(day(1), 14, 20, 1000)),
+			n:       3,
+		},
+		{
+			name:    "only today",
+			history: session(today, 0, 0, 1000),
+			n:       1,
+		},
+		{
+			name: "no history",
+			n:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		e := NewEvaluator(volumeState(t, tt.history), false)
+		got, ok := e.averageDailyVolume(ticker, tt.n)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("%s: averageDailyVolume = %v, %v; want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// sinceMidnight skips tests that need an hour of today's history when run
+// too soon after midnight UTC
+func sinceMidnight(t *testing.T) (time.Time, time.Time) {
+	t.Helper()
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	if now.Sub(today) < time.Hour {
+		t.Skip("needs an hour of today's history; too close to midnight UTC")
+	}
+	return now, today
+}
+
+func TestRecentVolume(t *testing.T) {
+	now, today := sinceMidnight(t)
+	day := func(n int) time.Time { return today.Add(-time.Duration(n) * 24 * time.Hour) }
+
+	// Checks every hour from 14:00 to 20:00 UTC, trading 1,000 an hour, so
+	// 500 per 30 minutes on average
+	steady := join(session(day(4), 14, 20, 1000), session(day(3), 14, 20, 1000),
+		session(day(2), 14, 20, 1000), session(day(1), 14, 20, 1000))
+	// The running total 31 minutes ago, just before the 30 minute period
+	ref := []state.PriceRecord{{Price: 100, Volume: 2000, Timestamp: now.Add(-31 * time.Minute)}}
+
+	tests := []struct {
+		name        string
+		history     []state.PriceRecord
+		current     int64
+		wantVolume  float64
+		wantAverage float64
+		wantOK      bool
+	}{
+		{
+			// 3,100 in the 31 minutes since the reference, scaled to 30
+			name:    "steady days",
+			history: join(steady, ref),
+			current: 5100, wantVolume: 3000, wantAverage: 500, wantOK: true,
+		},
+		{
+			// Gaps between sessions aren't counted as time without trading
+			name:    "missing days",
+			history: join(session(day(4), 14, 20, 1000), session(day(1), 14, 20, 1000), ref),
+			current: 5100, wantVolume: 3000, wantAverage: 500, wantOK: true,
+		},
+		{
+			// Only the three hours recorded on day 2 count
+			name:    "partial day",
+			history: join(session(day(4), 14, 20, 1000), session(day(2), 14, 17, 1000), ref),
+			current: 5100, wantVolume: 3000, wantAverage: 500, wantOK: true,
+		},
+		{
+			// The rise from a quiet 23:00 to 00:00 crosses the daily reset,
+			// so it isn't counted as 900 traded in that hour
+			name: "reset across midnight",
+			history: join(session(day(4), 14, 20, 1000), session(day(2), 23, 23, 100),
+				session(day(1), 0, 20, 1000), ref),
+			current: 5100, wantVolume: 3000, wantAverage: 500, wantOK: true,
+		},
+		{
+			name:    "history shorter than the days averaged",
+			history: join(session(day(2), 14, 20, 1000), session(day(1), 14, 20, 1000), ref),
+			current: 5100,
+		},
+		{
+			// The running total from yesterday can't be compared with today's
+			name:    "no reference today",
+			history: steady,
+			current: 5100,
+		},
+		{
+			name:    "reference above the current total",
+			history: join(steady, ref),
+			current: 1000,
+		},
+		{
+			name:    "no volume history",
+			history: join(session(day(4), 14, 14, 0), ref),
+			current: 5100,
+		},
+	}
+
+	for _, tt := range tests {
+		e := NewEvaluator(volumeState(t, tt.history), false)
+		volume, average, ok := e.recentVolume(ticker, tt.current, 30*time.Minute, 3)
+		if ok != tt.wantOK {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.wantOK)
+			continue
+		}
+		// The period is measured from the real clock, so allow for the
+		// time the test takes
+		if math.Abs(volume-tt.wantVolume) > 1 || math.Abs(average-tt.wantAverage) > 1e-6 {
+			t.Errorf("%s: volume %v, average %v; want %v, %v", tt.name, volume, average, tt.wantVolume, tt.wantAverage)
+		}
+	}
+}
+
+func TestReadVolume(t *testing.T) {
+	now, today := sinceMidnight(t)
+	day := func(n int) time.Time { return today.Add(-time.Duration(n) * 24 * time.Hour) }
+
+	history := join(session(day(4), 14, 20, 1000), session(day(3), 14, 20, 1000),
+		session(day(2), 14, 20, 1000), session(day(1), 14, 20, 1000),
+		[]state.PriceRecord{{Price: 98, Volume: 2000, Timestamp: now.Add(-31 * time.Minute)}})
+	spike := config.ConditionConfig{Type: "volume_spike", Value: 2, Length: 3}
+	unusual := config.ConditionConfig{Type: "unusual_volume", Value: 5, Period: "30m", Length: 3}
+
+	tests := []struct {
+		name     string
+		cond     config.ConditionConfig
+		volume   int64
+		multiple float64
+		signal   signal
+		wantOK   bool
+	}{
+		{"spike", spike, 14000, 2, signalActive, true},
+		{"no spike", spike, 13000, 13000 / 7000.0, signalClear, true},
+		{"unusual", unusual, 5100, 6, signalActive, true},
+		{"usual", unusual, 3550, 3, signalClear, true},
+		{"no volume reported", spike, 0, 0, signalClear, false},
+		{"not enough days", config.ConditionConfig{Type: "volume_spike", Value: 2, Length: 5}, 14000, 0, signalClear, false},
+	}
+
+	for _, tt := range tests {
+		st := volumeState(t, history)
+		st.UpdatePrice(ticker, 99, 0, 7*24*time.Hour, time.Hour)
+		e := NewEvaluator(st, false)
+		alert := config.AlertConfig{Ticker: ticker, Conditions: []config.ConditionConfig{tt.cond}}
+
+		r, ok := e.readVolume(alert, tt.cond, &yahoo.Quote{Price: 100, Volume: tt.volume})
+		if ok != tt.wantOK {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if math.Abs(r.volume.multiple-tt.multiple) > 1e-3 || r.signal != tt.signal {
+			t.Errorf("%s: %.3f× (signal %v), want %.3f× (signal %v)", tt.name, r.volume.multiple, r.signal, tt.multiple, tt.signal)
+		}
+		if r.reference != 99 || r.direction != "up" {
+			t.Errorf("%s: reference %v, direction %s; want the last price and up", tt.name, r.reference, r.direction)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/state"
+)
+
+// backfill fetches past prices from Yahoo for tickers whose conditions need
+// more history than has been recorded, back to the retention period
+func (r *runner) backfill(tickers []string) {
+	if !r.cfg.History.Backfill {
+		return
+	}
+
+	now := time.Now()
+	for _, ticker := range tickers {
+		needed := r.cfg.HistoryNeeded(ticker)
+		if needed == 0 {
+			continue
+		}
+		cutoff := now.Add(-needed)
+
+		r.st.Lock()
+		start, recorded := r.st.HistoryStart(ticker)
+		requested, done := r.st.Backfilled[ticker]
+		r.st.Unlock()
+
+		// Skip tickers with enough history, and tickers already fetched as
+		// far back as Yahoo has data
+		if (recorded && !start.After(cutoff)) || (done && !requested.After(cutoff)) {
+			continue
+		}
+
+		interval, maxAge := yahooInterval(r.finestInterval(ticker))
+		from := now.Add(-min(r.cfg.History.RetentionPeriod(), maxAge))
+		end := now
+		if recorded {
+			end = start
+		}
+
+		candles, err := r.yahoo.GetHistory(ticker, from, end, interval)
+		if err != nil {
+			log.Printf("Failed to backfill history for %s: %v", ticker, err)
+			continue
+		}
+
+		// Recorded volumes are the running total for the UTC day, so
+		// intraday candle volumes are accumulated to match
+		records := make([]state.PriceRecord, 0, len(candles))
+		var day time.Time
+		var volume int64
+		for _, c := range candles {
+			if d := c.Time.UTC().Truncate(24 * time.Hour); !d.Equal(day) {
+				day, volume = d, 0
+			}
+			volume += c.Volume
+			records = append(records, state.PriceRecord{Price: c.Close, High: c.High, Low: c.Low, Volume: volume, Timestamp: c.Time})
+		}
+
+		r.st.Lock()
+		r.st.Backfill(ticker, records, from)
+		r.st.Unlock()
+
+		if r.verbose {
+			log.Printf("Backfilled %d %s prices for %s", len(records), interval, ticker)
+		}
+	}
+}
+
+// finestInterval returns the smallest bar size among the ticker's conditions
+func (r *runner) finestInterval(ticker string) time.Duration {
+	var finest time.Duration
+	for _, cond := range r.cfg.Leaves(ticker) {
+		if d := cond.BarInterval(); d > 0 && (finest == 0 || d < finest) {
+			finest = d
+		}
+	}
+	return finest
+}
+
+// seedAllTimeHighs fetches the highest price in Yahoo's full monthly history
+// for tickers with new_all_time_high conditions whose all-time high isn't
+// known yet
+func (r *runner) seedAllTimeHighs(tickers []string) {
+	if !r.cfg.History.Backfill {
+		return
+	}
+
+	for _, ticker := range tickers {
+		wanted := false
+		for _, cond := range r.cfg.Leaves(ticker) {
+			wanted = wanted || cond.Type == "new_all_time_high"
+		}
+
+		r.st.Lock()
+		known := r.st.Extremes[ticker].AllTimeHigh > 0
+		r.st.Unlock()
+		if !wanted || known {
+			continue
+		}
+
+		candles, err := r.yahoo.GetHistory(ticker, time.Unix(0, 0), time.Now(), "1mo")
+		if err != nil {
+			log.Printf("Failed to fetch all-time high for %s: %v", ticker, err)
+			continue
+		}
+
+		high := 0.0
+		for _, c := range candles {
+			high = max(high, c.High)
+		}
+		if high == 0 {
+			continue
+		}
+
+		r.st.Lock()
+		r.st.UpdateExtremes(ticker, high, 0, 0)
+		r.st.Unlock()
+
+		if r.verbose {
+			log.Printf("All-time high for %s: $%.2f", ticker, high)
+		}
+	}
+}
+
+// yahooInterval picks the Yahoo bar size for backfilling bars of size d, and
+// how far back Yahoo serves that bar size
+func yahooInterval(d time.Duration) (string, time.Duration) {
+	switch {
+	case d >= 24*time.Hour:
+		return "1d", 100 * 365 * 24 * time.Hour
+	case d >= time.Hour:
+		return "1h", 729 * 24 * time.Hour
+	}
+	return "5m", 59 * 24 * time.Hour
+}
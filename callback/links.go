@@ -0,0 +1,55 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LinkTTL is how long a signed action link stays valid after it is sent
+const LinkTTL = 7 * 24 * time.Hour
+
+// SignedURL returns a link to the action at path (e.g. "/snooze") on the
+// callback server at baseURL, for the alert with the given key. The link
+// carries an expiry and an HMAC signature made with secret over the path and
+// every parameter, so it can't be altered, reused for another alert or
+// action, or used after it expires, and the secret itself is never sent.
+func SignedURL(baseURL, secret, path, key string, params url.Values, expires time.Time) string {
+	q := url.Values{}
+	for name, values := range params {
+		q[name] = values
+	}
+	q.Set("key", key)
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", sign(secret, path, q))
+
+	return baseURL + path + "?" + q.Encode()
+}
+
+// sign returns the signature of a request for path with query q
+func sign(secret, path string, q url.Values) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "?" + q.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature reports whether r carries an unexpired signature made with secret
+func validSignature(r *http.Request, secret string, now time.Time) bool {
+	q := r.URL.Query()
+	sig := q.Get("sig")
+	if sig == "" {
+		return false
+	}
+	q.Del("sig")
+
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(sig), []byte(sign(secret, r.URL.Path, q)))
+}
@@ -0,0 +1,117 @@
+package callback
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/state"
+)
+
+// maxSnooze bounds how long a single snooze request can silence an alert
+const maxSnooze = 7 * 24 * time.Hour
+
+// Server handles snooze and acknowledge requests sent by notification action buttons
+type Server struct {
+	state *state.State
+	token string
+	mux   *http.ServeMux
+}
+
+// NewServer creates a callback server that updates st. Requests must either
+// carry token as a bearer token or be a link signed with it by SignedURL.
+func NewServer(st *state.State, token string) *Server {
+	s := &Server{
+		state: st,
+		token: token,
+		mux:   http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/snooze", s.handleSnooze)
+	s.mux.HandleFunc("/ack", s.handleAck)
+
+	return s
+}
+
+// ServeHTTP authenticates the request and dispatches it
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether r carries the token or a valid signed link
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return false
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		got := strings.TrimPrefix(auth, "Bearer ")
+		return subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+	}
+	return validSignature(r, s.token, time.Now())
+}
+
+// handleSnooze suppresses an alert for the duration given in "for" (default 1h)
+func (s *Server) handleSnooze(w http.ResponseWriter, r *http.Request) {
+	duration := time.Hour
+	if v := r.URL.Query().Get("for"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxSnooze {
+			http.Error(w, fmt.Sprintf("invalid duration %q", v), http.StatusBadRequest)
+			return
+		}
+		duration = d
+	}
+
+	until := time.Now().Add(duration)
+	s.update(w, r, func(key string) {
+		s.state.Snooze(key, until)
+	}, fmt.Sprintf("snoozed until %s", until.Format(time.RFC3339)))
+}
+
+// handleAck acknowledges an alert, silencing it until it re-arms
+func (s *Server) handleAck(w http.ResponseWriter, r *http.Request) {
+	s.update(w, r, func(key string) {
+		s.state.Acknowledge(key)
+	}, "acknowledged")
+}
+
+// update applies fn to the requested alert key under the state lock and saves
+func (s *Server) update(w http.ResponseWriter, r *http.Request, fn func(key string), result string) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	if !s.state.HasAlert(key) {
+		http.Error(w, fmt.Sprintf("unknown alert %q", key), http.StatusNotFound)
+		return
+	}
+
+	fn(key)
+
+	if err := s.state.Save(); err != nil {
+		log.Printf("Failed to save state: %v", err)
+		http.Error(w, "failed to save state", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Alert %s %s", key, result)
+	fmt.Fprintf(w, "%s %s\n", key, result)
+}
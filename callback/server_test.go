@@ -0,0 +1,125 @@
+package callback
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/state"
+)
+
+const (
+	testSecret = "s3cret"
+	testKey    = "BTC-USD:above:100000.00"
+)
+
+func newTestServer(t *testing.T) (*Server, *state.State) {
+	t.Helper()
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("loading state: %v", err)
+	}
+	st.SetPhase(testKey, state.PhaseTriggered, time.Now())
+	st.SetPhase("ETH-USD:above:4000.00", state.PhaseTriggered, time.Now())
+	return NewServer(st, testSecret), st
+}
+
+// do sends a POST for link, which may be a full URL or a path
+func do(s *Server, link string, header string) *httptest.ResponseRecorder {
+	u, _ := url.Parse(link)
+	req := httptest.NewRequest(http.MethodPost, u.RequestURI(), nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSignedLinks(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	snooze := SignedURL("https://alerts.example.com", testSecret, "/snooze", testKey, url.Values{"for": {"1h"}}, expires)
+	ack := SignedURL("https://alerts.example.com", testSecret, "/ack", testKey, nil, expires)
+
+	if strings.Contains(snooze, testSecret) {
+		t.Fatalf("link %s contains the secret", snooze)
+	}
+
+	tests := []struct {
+		name string
+		link string
+		want int
+	}{
+		{"snooze", snooze, http.StatusOK},
+		{"ack", ack, http.StatusOK},
+		{"unsigned", "/ack?key=" + url.QueryEscape(testKey), http.StatusUnauthorized},
+		{"other action", strings.Replace(ack, "/ack", "/snooze", 1), http.StatusUnauthorized},
+		{"other alert", strings.Replace(ack, "BTC-USD", "ETH-USD", 1), http.StatusUnauthorized},
+		{"longer snooze", strings.Replace(snooze, "for=1h", "for=168h", 1), http.StatusUnauthorized},
+		{"other secret", SignedURL("", "guess", "/ack", testKey, nil, expires), http.StatusUnauthorized},
+		{"expired", SignedURL("", testSecret, "/ack", testKey, nil, time.Now().Add(-time.Minute)), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			if rec := do(s, tt.link, ""); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"Bearer " + testSecret, http.StatusOK},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		s, st := newTestServer(t)
+		rec := do(s, "/ack?key="+url.QueryEscape(testKey), tt.header)
+		if rec.Code != tt.want {
+			t.Errorf("%q: status = %d, want %d", tt.header, rec.Code, tt.want)
+		}
+		if acked := st.IsAcknowledged(testKey); acked != (tt.want == http.StatusOK) {
+			t.Errorf("%q: acknowledged = %v", tt.header, acked)
+		}
+	}
+}
+
+func TestNoTokenRejectsEverything(t *testing.T) {
+	st, _ := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	st.SetPhase(testKey, state.PhaseTriggered, time.Now())
+	s := NewServer(st, "")
+
+	link := SignedURL("", "", "/ack", testKey, nil, time.Now().Add(time.Hour))
+	for _, header := range []string{"", "Bearer "} {
+		if rec := do(s, link, header); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%q: status = %d, want 401", header, rec.Code)
+		}
+	}
+}
+
+func TestSnoozeUpdatesState(t *testing.T) {
+	s, st := newTestServer(t)
+	link := SignedURL("", testSecret, "/snooze", testKey, url.Values{"for": {"1h"}}, time.Now().Add(time.Hour))
+
+	if rec := do(s, link, ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if !st.IsSnoozed(testKey) {
+		t.Error("alert isn't snoozed")
+	}
+	if phase := st.Condition(testKey).Phase; phase != state.PhaseArmed {
+		t.Errorf("phase = %s, want armed", phase)
+	}
+}
@@ -0,0 +1,124 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+// Sparkline dimensions in pixels
+const (
+	Width   = 400
+	Height  = 120
+	padding = 8
+)
+
+var (
+	background    = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	upColor       = color.RGBA{0x2E, 0xB6, 0x7D, 0xFF}
+	downColor     = color.RGBA{0xE0, 0x1E, 0x5A, 0xFF}
+	thresholdGray = color.RGBA{0x80, 0x80, 0x80, 0xFF}
+)
+
+// Sparkline renders prices as a PNG line chart, colored green if the series
+// ends higher than it started and red otherwise. If threshold is non-zero a
+// dashed horizontal line is drawn at that price.
+func Sparkline(prices []float64, threshold float64) ([]byte, error) {
+	if len(prices) < 2 {
+		return nil, fmt.Errorf("need at least 2 prices, got %d", len(prices))
+	}
+
+	lo, hi := prices[0], prices[0]
+	for _, p := range prices {
+		lo = math.Min(lo, p)
+		hi = math.Max(hi, p)
+	}
+	if threshold != 0 {
+		lo = math.Min(lo, threshold)
+		hi = math.Max(hi, threshold)
+	}
+	if hi == lo {
+		hi, lo = hi+1, lo-1
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	for x := 0; x < Width; x++ {
+		for y := 0; y < Height; y++ {
+			img.Set(x, y, background)
+		}
+	}
+
+	toY := func(price float64) int {
+		scaled := (price - lo) / (hi - lo)
+		return padding + int(math.Round((1-scaled)*float64(Height-2*padding-1)))
+	}
+	toX := func(i int) int {
+		return padding + i*(Width-2*padding-1)/(len(prices)-1)
+	}
+
+	if threshold != 0 {
+		y := toY(threshold)
+		for x := padding; x < Width-padding; x++ {
+			if (x/6)%2 == 0 {
+				img.Set(x, y, thresholdGray)
+			}
+		}
+	}
+
+	lineColor := upColor
+	if prices[len(prices)-1] < prices[0] {
+		lineColor = downColor
+	}
+
+	for i := 1; i < len(prices); i++ {
+		drawLine(img, toX(i-1), toY(prices[i-1]), toX(i), toY(prices[i]), lineColor)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encoding png: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// drawLine draws a 2px line from (x0, y0) to (x1, y1) using Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx := abs(x1 - x0)
+	dy := -abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+
+	for {
+		img.Set(x0, y0, c)
+		img.Set(x0, y0+1, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -2,43 +2,698 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/vcavallo/asset-alerts/expr"
+	"github.com/vcavallo/asset-alerts/message"
+	"github.com/vcavallo/asset-alerts/period"
 )
 
 // Config represents the top-level configuration
 type Config struct {
-	Ntfy          NtfyConfig    `yaml:"ntfy"`
-	CheckInterval string        `yaml:"check_interval"`
-	Alerts        []AlertConfig `yaml:"alerts"`
+	Ntfy          NtfyConfig     `yaml:"ntfy"`
+	Slack         SlackConfig    `yaml:"slack"`
+	Discord       DiscordConfig  `yaml:"discord"`
+	Email         EmailConfig    `yaml:"email"`
+	Telegram      TelegramConfig `yaml:"telegram"`
+	Matrix        MatrixConfig   `yaml:"matrix"`
+	Webhook       WebhookConfig  `yaml:"webhook"`
+	Exec          ExecConfig     `yaml:"exec"`
+	CheckInterval string         `yaml:"check_interval"`
+	Daemon        DaemonConfig   `yaml:"daemon"`
+	Outbox        OutboxConfig   `yaml:"outbox"`
+	Grouping      GroupingConfig `yaml:"grouping"`
+	Digests       []DigestConfig `yaml:"digests"`
+	QuietHours    []QuietHours   `yaml:"quiet_hours"`
+	History       HistoryConfig  `yaml:"history"`
+	Alerts        []AlertConfig  `yaml:"alerts"`
+}
+
+// HistoryConfig controls how much price history is kept for change,
+// expression and indicator conditions
+type HistoryConfig struct {
+	Retention string `yaml:"retention"` // how long recorded prices are kept, e.g. "30d", default "7d"
+	Backfill  bool   `yaml:"backfill"`  // fetch past prices from Yahoo when conditions need more history than is recorded
+}
+
+// RetentionPeriod returns how long recorded prices are kept. The retention
+// is expected to have been validated by Load.
+func (h HistoryConfig) RetentionPeriod() time.Duration {
+	d, _ := period.Parse(h.Retention)
+	return d
+}
+
+// DaemonConfig holds settings for long-running (--daemon) mode
+type DaemonConfig struct {
+	Interval  string `yaml:"interval"`   // time between checks, default "5m"
+	Listen    string `yaml:"listen"`     // callback server address, e.g. ":8080" (optional)
+	PublicURL string `yaml:"public_url"` // base URL notification actions use to reach the callback server
+	Token     string `yaml:"token"`      // secret that signs action links and authenticates callback requests, required with listen
+}
+
+// OutboxConfig controls how failed deliveries are retried across runs
+type OutboxConfig struct {
+	MaxAge     string `yaml:"max_age"`     // give up on undelivered alerts after this long, default "24h"
+	Backoff    string `yaml:"backoff"`     // delay before the first retry, doubled per attempt, default "1m"
+	MaxBackoff string `yaml:"max_backoff"` // upper bound on the retry delay, default "1h"
+}
+
+// GroupingConfig controls combining alerts from one run into fewer notifications
+type GroupingConfig struct {
+	Mode    string `yaml:"mode"`     // "none" (default), "run" (one per run), or "group" (one per alert group)
+	MaxSize int    `yaml:"max_size"` // send individually when a group has more alerts than this, default 10
+}
+
+// DigestConfig describes a scheduled summary of watched tickers
+type DigestConfig struct {
+	Name     string   `yaml:"name"`     // identifies the digest in state and on the command line, default the schedule
+	Title    string   `yaml:"title"`    // notification title, default "Daily digest" or "Weekly digest"
+	Schedule string   `yaml:"schedule"` // "daily" (default) or "weekly"
+	Weekday  string   `yaml:"weekday"`  // day weekly digests are sent, default "monday"
+	At       string   `yaml:"at"`       // time of day as "HH:MM", default "08:00"
+	Timezone string   `yaml:"timezone"` // IANA time zone for at, default the system zone
+	Notifier string   `yaml:"notifier"` // notifier to send through (e.g. "ntfy"); empty sends through all
+	Tickers  []string `yaml:"tickers"`  // tickers to include, default every configured ticker
+	Include  []string `yaml:"include"`  // price, change_24h, change_7d, nearest_threshold (default all)
+}
+
+// DigestFields lists the values a digest can include for each ticker
+var DigestFields = []string{"price", "change_24h", "change_7d", "nearest_threshold"}
+
+// Location returns the digest's time zone. The name is expected to have
+// been validated by Load.
+func (d DigestConfig) Location() *time.Location {
+	return loadLocation(d.Timezone)
+}
+
+// QuietHours is a daily window during which alerts below a priority cutoff
+// are held and delivered together when the window ends
+type QuietHours struct {
+	Start       string   `yaml:"start"`        // "HH:MM"
+	End         string   `yaml:"end"`          // "HH:MM", earlier than start for windows spanning midnight
+	Timezone    string   `yaml:"timezone"`     // IANA time zone, default the system zone
+	MinPriority int      `yaml:"min_priority"` // alerts at or above this priority are delivered anyway, default 5
+	Notifiers   []string `yaml:"notifiers"`    // notifiers the window applies to, default all
+}
+
+// Until reports whether t falls inside the window and, if so, when the
+// window ends. Times are expected to have been validated by Load.
+func (q QuietHours) Until(t time.Time) (time.Time, bool) {
+	start, _ := time.Parse("15:04", q.Start)
+	end, _ := time.Parse("15:04", q.End)
+
+	loc := loadLocation(q.Timezone)
+	local := t.In(loc)
+	day := func(clock time.Time, offset int) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day()+offset, clock.Hour(), clock.Minute(), 0, 0, loc)
+	}
+
+	s, e := day(start, 0), day(end, 0)
+	if s.Before(e) {
+		return e, !local.Before(s) && local.Before(e)
+	}
+
+	// The window spans midnight
+	if !local.Before(s) {
+		return day(end, 1), true
+	}
+	return e, local.Before(e)
+}
+
+// QuietUntil reports whether quiet hours hold back a notification of the
+// given priority on the named notifier at t and, if so, until when. extra is
+// an alert's own window, or nil.
+func (c *Config) QuietUntil(notifier string, priority int, extra *QuietHours, t time.Time) (time.Time, bool) {
+	windows := c.QuietHours
+	if extra != nil {
+		windows = append(windows[:len(windows):len(windows)], *extra)
+	}
+
+	var latest time.Time
+	for _, q := range windows {
+		if !q.AppliesTo(notifier) || priority >= q.MinPriority {
+			continue
+		}
+		if until, ok := q.Until(t); ok && until.After(latest) {
+			latest = until
+		}
+	}
+
+	return latest, !latest.IsZero()
+}
+
+// AppliesTo reports whether the window covers the named notifier
+func (q QuietHours) AppliesTo(notifier string) bool {
+	if len(q.Notifiers) == 0 {
+		return true
+	}
+	for _, n := range q.Notifiers {
+		if n == notifier {
+			return true
+		}
+	}
+	return false
+}
+
+// loadLocation returns the named time zone, or the system zone if name is empty
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
 }
 
 // NtfyConfig holds ntfy server configuration
 type NtfyConfig struct {
-	Server   string `yaml:"server"`
-	Topic    string `yaml:"topic"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Token    string `yaml:"token"`
-	Priority int    `yaml:"priority"`
+	Server   string   `yaml:"server"`
+	Topic    string   `yaml:"topic"`
+	Username string   `yaml:"username" json:"-"`
+	Password string   `yaml:"password" json:"-"`
+	Token    string   `yaml:"token" json:"-"`
+	Priority int      `yaml:"priority"`
+	Tags     []string `yaml:"tags"`     // extra tags added to every notification
+	Icon     string   `yaml:"icon"`     // notification icon URL
+	Markdown bool     `yaml:"markdown"` // send Markdown bodies with a price/threshold/change table
+	Click    string   `yaml:"click"`    // "quote" (default), "none", or a URL where {ticker} is replaced
+}
+
+// NtfyOverride overrides ntfy settings for a single alert or condition.
+// Zero values leave the inherited setting unchanged; tags are added to the
+// inherited tags.
+type NtfyOverride struct {
+	Server   string   `yaml:"server"`
+	Topic    string   `yaml:"topic"`
+	Username string   `yaml:"username" json:"-"`
+	Password string   `yaml:"password" json:"-"`
+	Token    string   `yaml:"token" json:"-"`
+	Priority int      `yaml:"priority"`
+	Tags     []string `yaml:"tags"`
+	Icon     string   `yaml:"icon"`
+}
+
+// WithOverrides applies overrides in order, later ones taking precedence.
+// Credentials are only inherited when the server is unchanged, so they are
+// never sent to a different server than they were configured for.
+func (n NtfyConfig) WithOverrides(overrides ...*NtfyOverride) NtfyConfig {
+	merged := n
+	merged.Tags = append([]string(nil), n.Tags...)
+
+	for _, o := range overrides {
+		if o == nil {
+			continue
+		}
+		if o.Server != "" && o.Server != merged.Server {
+			merged.Server = o.Server
+			merged.Username = ""
+			merged.Password = ""
+			merged.Token = ""
+		}
+		if o.Topic != "" {
+			merged.Topic = o.Topic
+		}
+		if o.Username != "" || o.Password != "" || o.Token != "" {
+			merged.Username = o.Username
+			merged.Password = o.Password
+			merged.Token = o.Token
+		}
+		if o.Priority != 0 {
+			merged.Priority = o.Priority
+		}
+		if o.Icon != "" {
+			merged.Icon = o.Icon
+		}
+		merged.Tags = append(merged.Tags, o.Tags...)
+	}
+
+	return merged
+}
+
+// Enabled reports whether ntfy delivery is configured
+func (n NtfyConfig) Enabled() bool {
+	return n.Server != "" || n.Topic != ""
+}
+
+// SlackConfig holds Slack incoming webhook configuration
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Username   string `yaml:"username"` // optional, legacy webhooks only
+	Channel    string `yaml:"channel"`  // optional, legacy webhooks only
+}
+
+// Enabled reports whether Slack delivery is configured
+func (s SlackConfig) Enabled() bool {
+	return s.WebhookURL != ""
+}
+
+// DiscordConfig holds Discord webhook configuration
+type DiscordConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Username   string `yaml:"username"`   // optional, overrides the webhook's name
+	AvatarURL  string `yaml:"avatar_url"` // optional, overrides the webhook's avatar
+}
+
+// Enabled reports whether Discord delivery is configured
+func (d DiscordConfig) Enabled() bool {
+	return d.WebhookURL != ""
+}
+
+// EmailConfig holds SMTP email configuration
+type EmailConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"` // default 465 for implicit TLS, 587 otherwise
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	TLS      string   `yaml:"tls"`    // "starttls" (default), "implicit", or "none"
+	Digest   bool     `yaml:"digest"` // send one HTML summary per run instead of one email per alert
+}
+
+// Enabled reports whether email delivery is configured
+func (e EmailConfig) Enabled() bool {
+	return e.Host != ""
+}
+
+// TelegramConfig holds Telegram Bot API configuration
+type TelegramConfig struct {
+	BotToken   string `yaml:"bot_token"`
+	ChatID     string `yaml:"chat_id"`     // default chat, overridable per alert
+	APIURL     string `yaml:"api_url"`     // default https://api.telegram.org
+	MaxRetries int    `yaml:"max_retries"` // retries on rate limiting, default 3
+}
+
+// Enabled reports whether Telegram delivery is configured
+func (t TelegramConfig) Enabled() bool {
+	return t.BotToken != ""
+}
+
+// MatrixConfig holds Matrix client-server API configuration
+type MatrixConfig struct {
+	Homeserver  string `yaml:"homeserver"`
+	AccessToken string `yaml:"access_token"`
+	RoomID      string `yaml:"room_id"`     // default room, overridable per alert
+	MaxRetries  int    `yaml:"max_retries"` // retries on rate limiting, default 3
+}
+
+// Enabled reports whether Matrix delivery is configured
+func (m MatrixConfig) Enabled() bool {
+	return m.Homeserver != ""
+}
+
+// WebhookConfig holds generic outbound webhook configuration
+type WebhookConfig struct {
+	URL        string `yaml:"url"`
+	Secret     string `yaml:"secret"`      // HMAC-SHA256 signing key, required
+	MaxRetries int    `yaml:"max_retries"` // default 3
+	RetryDelay string `yaml:"retry_delay"` // initial backoff, doubled per retry; default "2s"
+}
+
+// Enabled reports whether webhook delivery is configured
+func (w WebhookConfig) Enabled() bool {
+	return w.URL != ""
+}
+
+// ExecConfig holds configuration for piping alerts to a local command
+type ExecConfig struct {
+	Command []string `yaml:"command"` // program followed by its arguments
+	Timeout string   `yaml:"timeout"` // default "30s"
+	Batch   bool     `yaml:"batch"`   // run once per run with all alerts instead of once per alert
+}
+
+// Enabled reports whether exec delivery is configured
+func (e ExecConfig) Enabled() bool {
+	return len(e.Command) > 0
 }
 
 // AlertConfig represents an alert for a specific ticker
 type AlertConfig struct {
-	Ticker     string            `yaml:"ticker"`
-	Name       string            `yaml:"name"`
-	Conditions []ConditionConfig `yaml:"conditions"`
+	Ticker         string            `yaml:"ticker"`
+	Name           string            `yaml:"name"`
+	TelegramChatID string            `yaml:"telegram_chat_id"` // overrides telegram.chat_id
+	MatrixRoomID   string            `yaml:"matrix_room_id"`   // overrides matrix.room_id
+	Ntfy           *NtfyOverride     `yaml:"ntfy"`             // overrides ntfy settings
+	Chart          bool              `yaml:"chart"`            // attach a price chart to ntfy notifications
+	Group          string            `yaml:"group"`            // group label for grouping.mode "group"
+	QuietHours     *QuietHours       `yaml:"quiet_hours"`      // quiet window for this alert, in addition to the global ones
+	Conditions     []ConditionConfig `yaml:"conditions"`
 }
 
 // ConditionConfig represents a single alert condition
 type ConditionConfig struct {
-	Type    string  `yaml:"type"`    // "above", "below", "percent_change"
-	Value   float64 `yaml:"value"`   // threshold price or percentage
-	Period  string  `yaml:"period"`  // for percent_change: "24h", "1h", etc.
-	Message string  `yaml:"message"` // custom alert message (optional)
+	Type        string        `yaml:"type"`         // "above", "below", "percent_change"
+	Value       float64       `yaml:"value"`        // threshold price or percentage, or multiple of average volume
+	Period      string        `yaml:"period"`       // for percent_change and unusual_volume: "24h", "1h", etc.
+	Message     string        `yaml:"message"`      // custom alert message, may be a Go template (optional)
+	Title       string        `yaml:"title"`        // custom notification title, may be a Go template (optional)
+	Ntfy        *NtfyOverride `yaml:"ntfy"`         // overrides alert and global ntfy settings
+	Cooldown    string        `yaml:"cooldown"`     // minimum time between notifications, even if re-crossed (optional)
+	RepeatEvery string        `yaml:"repeat_every"` // remind this often while the condition holds, until acknowledged (optional)
+	ResetBand   string        `yaml:"reset_band"`   // above/below: distance back across the level needed to re-arm, e.g. 500 or "2%" (optional)
+	TriggerOn   string        `yaml:"trigger_on"`   // "level" (default), "cross", or "first_seen"
+	Expression  string        `yaml:"expression"`   // for expression: e.g. `price / sma(50) > 1.1 && change("24h") < -3`
+	Fast        int           `yaml:"fast"`         // for crosses and macd: bars in the fast moving average (macd default 12)
+	Slow        int           `yaml:"slow"`         // for crosses and macd: bars in the slow moving average (macd default 26)
+	Signal      int           `yaml:"signal"`       // for macd: bars in the signal line, default 9
+	Length      int           `yaml:"length"`       // for rsi, bollinger and atr: bars, default 14 (bollinger 20); for volume: days averaged, default 20
+	Deviations  float64       `yaml:"deviations"`   // for bollinger: band width in standard deviations, default 2
+	Interval    string        `yaml:"interval"`     // for indicator conditions: bar size, default "1d"
+	Trail       string        `yaml:"trail"`        // for trailing_stop: distance below the high, e.g. "8%" or 5000
+	Activation  float64       `yaml:"activation"`   // for trailing_stop and drawdown: price the high must reach before tracking starts (optional)
+	Reset       string        `yaml:"reset"`        // for trailing_stop and drawdown: "recover" (default), "new_high", or "never"
+	Direction   string        `yaml:"direction"`    // crosses and macd: "up", "down", or "both" (default); rsi and atr: "above" or "below"; bollinger: "above", "below", or "outside" (default)
+
+	// Compound conditions set exactly one of these instead of a type. Their
+	// leaves are regular conditions without messages or delivery settings.
+	All []ConditionConfig `yaml:"all"` // holds when every child holds
+	Any []ConditionConfig `yaml:"any"` // holds when at least one child holds
+	Not *ConditionConfig  `yaml:"not"` // holds when the child doesn't
+}
+
+// Operator returns "all", "any" or "not" for compound conditions, or "" for leaves
+func (c ConditionConfig) Operator() string {
+	switch {
+	case c.All != nil:
+		return "all"
+	case c.Any != nil:
+		return "any"
+	case c.Not != nil:
+		return "not"
+	}
+	return ""
+}
+
+// Children returns the sub-conditions of a compound condition
+func (c ConditionConfig) Children() []ConditionConfig {
+	switch c.Operator() {
+	case "all":
+		return c.All
+	case "any":
+		return c.Any
+	case "not":
+		return []ConditionConfig{*c.Not}
+	}
+	return nil
+}
+
+// Canonical returns a compact identity for the condition, e.g.
+// "all(below:90000.00,percent_change:5.00:24h)". Compound alerts are keyed by it.
+func (c ConditionConfig) Canonical() string {
+	if op := c.Operator(); op != "" {
+		var parts []string
+		for _, child := range c.Children() {
+			parts = append(parts, child.Canonical())
+		}
+		return fmt.Sprintf("%s(%s)", op, strings.Join(parts, ","))
+	}
+
+	switch c.Type {
+	case "expression":
+		return "expression:" + c.Expression
+	case "volume_spike", "unusual_volume":
+		return fmt.Sprintf("%s:%.2f:%d:%s", c.Type, c.Value, c.Length, c.Period)
+	case "trailing_stop", "drawdown":
+		return fmt.Sprintf("%s:%.2f:%s:%.2f:%s", c.Type, c.Value, c.Trail, c.Activation, c.Reset)
+	case "sma_cross", "ema_cross":
+		return fmt.Sprintf("%s:%d:%d:%s:%s", c.Type, c.Fast, c.Slow, c.Interval, c.Direction)
+	case "rsi", "atr":
+		return fmt.Sprintf("%s:%d:%s:%s:%.2f", c.Type, c.Length, c.Interval, c.Direction, c.Value)
+	case "bollinger":
+		return fmt.Sprintf("bollinger:%d:%.2f:%s:%s", c.Length, c.Deviations, c.Interval, c.Direction)
+	case "macd":
+		return fmt.Sprintf("macd:%d:%d:%d:%s:%s", c.Fast, c.Slow, c.Signal, c.Interval, c.Direction)
+	}
+
+	id := fmt.Sprintf("%s:%.2f", c.Type, c.Value)
+	if c.Period != "" {
+		id += ":" + c.Period
+	}
+	return id
+}
+
+// ResetLevel returns the price an above/below condition must move back past
+// to re-arm, and whether a reset_band is set. Without a band it is the
+// threshold itself. The band is expected to have been validated by Load.
+func (c ConditionConfig) ResetLevel() (float64, bool) {
+	band, err := c.resetBand()
+	if err != nil || band == 0 {
+		return c.Value, false
+	}
+	if c.Type == "below" {
+		return c.Value + band, true
+	}
+	return c.Value - band, true
+}
+
+// resetBand parses reset_band as an absolute amount or a percentage of the threshold
+func (c ConditionConfig) resetBand() (float64, error) {
+	if c.ResetBand == "" {
+		return 0, nil
+	}
+
+	band, percent, err := parseAmount(c.ResetBand)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reset_band %q", c.ResetBand)
+	}
+	if percent {
+		band = c.Value * band / 100
+	}
+	return band, nil
+}
+
+// StopLevel returns the price at which a trailing stop or drawdown condition
+// fires, given its high-water mark. The trail is expected to have been
+// validated by Load.
+func (c ConditionConfig) StopLevel(high float64) float64 {
+	if c.Type == "drawdown" {
+		return high * (1 - c.Value/100)
+	}
+
+	trail, percent, _ := parseAmount(c.Trail)
+	if percent {
+		return high * (1 - trail/100)
+	}
+	return high - trail
+}
+
+// parseAmount parses an absolute amount like "500" or a percentage like "2%"
+func parseAmount(s string) (float64, bool, error) {
+	text := strings.TrimSpace(s)
+	percent := strings.HasSuffix(text, "%")
+	amount, err := strconv.ParseFloat(strings.TrimSuffix(text, "%"), 64)
+	return amount, percent, err
+}
+
+// Describe summarizes the condition, e.g. "above $100000.00"
+func (c ConditionConfig) Describe() string {
+	if op := c.Operator(); op != "" {
+		var parts []string
+		for _, child := range c.Children() {
+			parts = append(parts, child.Describe())
+		}
+		if op == "not" {
+			return fmt.Sprintf("not (%s)", parts[0])
+		}
+		return fmt.Sprintf("%s of (%s)", op, strings.Join(parts, ", "))
+	}
+
+	switch c.Type {
+	case "above", "below":
+		return fmt.Sprintf("%s $%.2f", c.Type, c.Value)
+	case "percent_change":
+		return fmt.Sprintf("%.1f%% change in %s", c.Value, c.Period)
+	case "absolute_change":
+		return fmt.Sprintf("$%.2f change in %s", c.Value, c.Period)
+	case "expression":
+		return c.Expression
+	case "sma_cross", "ema_cross":
+		ma := strings.ToUpper(strings.TrimSuffix(c.Type, "_cross"))
+		return fmt.Sprintf("%s(%d) crossing %s(%d) on %s bars", ma, c.Fast, ma, c.Slow, c.Interval)
+	case "trailing_stop":
+		return fmt.Sprintf("trailing stop %s below the high", c.Trail)
+	case "drawdown":
+		return fmt.Sprintf("%.1f%% drawdown from the high", c.Value)
+	case "new_52w_high":
+		return "new 52-week high"
+	case "new_52w_low":
+		return "new 52-week low"
+	case "near_52w_high":
+		return fmt.Sprintf("within %.1f%% of the 52-week high", c.Value)
+	case "new_all_time_high":
+		return "new all-time high"
+	case "volume_spike":
+		return fmt.Sprintf("volume %.1f× the %d-day average", c.Value, c.Length)
+	case "unusual_volume":
+		return fmt.Sprintf("%s volume %.1f× its usual rate", c.Period, c.Value)
+	case "rsi":
+		return fmt.Sprintf("RSI(%d) %s %.0f on %s bars", c.Length, c.Direction, c.Value, c.Interval)
+	case "atr":
+		return fmt.Sprintf("ATR(%d) %s $%.2f on %s bars", c.Length, c.Direction, c.Value, c.Interval)
+	case "bollinger":
+		return fmt.Sprintf("%s Bollinger Bands(%d, %.1f) on %s bars", c.Direction, c.Length, c.Deviations, c.Interval)
+	case "macd":
+		return fmt.Sprintf("MACD(%d,%d,%d) crossing its signal line on %s bars", c.Fast, c.Slow, c.Signal, c.Interval)
+	}
+	return c.Type
+}
+
+// IsCross reports whether the condition is a moving average crossover
+func (c ConditionConfig) IsCross() bool {
+	return c.Type == "sma_cross" || c.Type == "ema_cross"
+}
+
+// IsIndicator reports whether the condition is computed from price history
+// resampled into bars: crossovers and the technical indicators
+func (c ConditionConfig) IsIndicator() bool {
+	switch c.Type {
+	case "sma_cross", "ema_cross", "rsi", "bollinger", "macd", "atr":
+		return true
+	}
+	return false
+}
+
+// Bars returns how many bars an indicator condition needs, including the
+// previous bar for conditions that detect crossings
+func (c ConditionConfig) Bars() int {
+	switch c.Type {
+	case "sma_cross", "ema_cross":
+		return c.Slow + 1
+	case "macd":
+		return c.Slow + c.Signal
+	case "rsi", "atr":
+		return c.Length + 1
+	case "bollinger":
+		return c.Length
+	}
+	return 0
+}
+
+// IsRecord reports whether the condition compares price with a 52-week or all-time record
+func (c ConditionConfig) IsRecord() bool {
+	switch c.Type {
+	case "new_52w_high", "new_52w_low", "near_52w_high", "new_all_time_high":
+		return true
+	}
+	return false
+}
+
+// IsVolume reports whether the condition compares volume with its average
+func (c ConditionConfig) IsVolume() bool {
+	return c.Type == "volume_spike" || c.Type == "unusual_volume"
+}
+
+// BarInterval returns the granularity of history the condition works on:
+// the bar size of indicators, a day for volume_spike and an hour for
+// unusual_volume and for expressions with duration windows. It is 0 for
+// other conditions.
+func (c ConditionConfig) BarInterval() time.Duration {
+	switch {
+	case c.Type == "expression" && c.HistoryNeeded() > 0:
+		return time.Hour
+	case c.IsIndicator():
+		return c.IntervalPeriod()
+	case c.Type == "volume_spike":
+		return 24 * time.Hour
+	case c.Type == "unusual_volume":
+		return time.Hour
+	}
+	return 0
+}
+
+// IntervalPeriod returns the bar size of an indicator condition. The interval
+// is expected to have been validated by Load.
+func (c ConditionConfig) IntervalPeriod() time.Duration {
+	d, _ := period.Parse(c.Interval)
+	return d
+}
+
+// HistoryNeeded returns how far back the condition needs price history.
+// Indicator conditions need their bars, and volume conditions the days they
+// average over plus today, with half as much again to allow for weekends
+// when markets are closed. Expressions need their longest duration window.
+func (c ConditionConfig) HistoryNeeded() time.Duration {
+	var needed time.Duration
+	for _, child := range c.Children() {
+		needed = max(needed, child.HistoryNeeded())
+	}
+	if c.IsIndicator() {
+		needed = max(needed, time.Duration(c.Bars())*c.IntervalPeriod()*3/2)
+	}
+	if c.IsVolume() {
+		needed = max(needed, time.Duration(c.Length+1)*24*time.Hour*3/2)
+	}
+	if c.Type == "expression" {
+		if x, err := expr.Parse(c.Expression); err == nil {
+			needed = max(needed, x.Lookback())
+		}
+	}
+	return needed
+}
+
+// Leaves returns the ticker's conditions, with compound conditions replaced
+// by the leaf conditions inside them
+func (c *Config) Leaves(ticker string) []ConditionConfig {
+	var leaves []ConditionConfig
+	var walk func(cond ConditionConfig)
+	walk = func(cond ConditionConfig) {
+		if cond.Operator() == "" {
+			leaves = append(leaves, cond)
+		}
+		for _, child := range cond.Children() {
+			walk(child)
+		}
+	}
+
+	for _, alert := range c.Alerts {
+		if !strings.EqualFold(alert.Ticker, ticker) {
+			continue
+		}
+		for _, cond := range alert.Conditions {
+			walk(cond)
+		}
+	}
+	return leaves
+}
+
+// HistoryNeeded returns how far back the ticker's conditions need price history
+func (c *Config) HistoryNeeded(ticker string) time.Duration {
+	var needed time.Duration
+	for _, alert := range c.Alerts {
+		if !strings.EqualFold(alert.Ticker, ticker) {
+			continue
+		}
+		for _, cond := range alert.Conditions {
+			needed = max(needed, cond.HistoryNeeded())
+		}
+	}
+	return needed
+}
+
+// HistoryResolution returns how finely the ticker's price history needs to be
+// kept once it is more than a day old: the finest bar interval among its
+// conditions, an hour for change and expression conditions, which look up
+// prices at any time, and a day otherwise
+func (c *Config) HistoryResolution(ticker string) time.Duration {
+	resolution := 24 * time.Hour
+	for _, cond := range c.Leaves(ticker) {
+		switch {
+		case cond.BarInterval() > 0:
+			resolution = min(resolution, cond.BarInterval())
+		case cond.Type == "percent_change", cond.Type == "absolute_change", cond.Type == "expression":
+			resolution = min(resolution, time.Hour)
+		}
+	}
+	return resolution
 }
 
 // Load reads and parses the configuration file
@@ -60,6 +715,91 @@ func Load(path string) (*Config, error) {
 	if cfg.Ntfy.Priority == 0 {
 		cfg.Ntfy.Priority = 3
 	}
+	if cfg.Telegram.APIURL == "" {
+		cfg.Telegram.APIURL = "https://api.telegram.org"
+	}
+	if cfg.Telegram.MaxRetries == 0 {
+		cfg.Telegram.MaxRetries = 3
+	}
+	if cfg.Matrix.MaxRetries == 0 {
+		cfg.Matrix.MaxRetries = 3
+	}
+	if cfg.Webhook.MaxRetries == 0 {
+		cfg.Webhook.MaxRetries = 3
+	}
+	if cfg.Webhook.RetryDelay == "" {
+		cfg.Webhook.RetryDelay = "2s"
+	}
+	if cfg.Exec.Timeout == "" {
+		cfg.Exec.Timeout = "30s"
+	}
+	if cfg.Outbox.MaxAge == "" {
+		cfg.Outbox.MaxAge = "24h"
+	}
+	if cfg.Outbox.Backoff == "" {
+		cfg.Outbox.Backoff = "1m"
+	}
+	if cfg.Outbox.MaxBackoff == "" {
+		cfg.Outbox.MaxBackoff = "1h"
+	}
+	if cfg.Grouping.Mode == "" {
+		cfg.Grouping.Mode = "none"
+	}
+	if cfg.History.Retention == "" {
+		cfg.History.Retention = "7d"
+	}
+	if cfg.Grouping.MaxSize == 0 {
+		cfg.Grouping.MaxSize = 10
+	}
+	for i := range cfg.Digests {
+		d := &cfg.Digests[i]
+		if d.Schedule == "" {
+			d.Schedule = "daily"
+		}
+		if d.Name == "" {
+			d.Name = d.Schedule
+		}
+		if d.Weekday == "" {
+			d.Weekday = "monday"
+		}
+		if d.At == "" {
+			d.At = "08:00"
+		}
+		if len(d.Include) == 0 {
+			d.Include = DigestFields
+		}
+	}
+	for i := range cfg.Alerts {
+		for j := range cfg.Alerts[i].Conditions {
+			cond := &cfg.Alerts[i].Conditions[j]
+			if cond.TriggerOn == "" {
+				cond.TriggerOn = "level"
+			}
+			setConditionDefaults(cond)
+		}
+	}
+	for i := range cfg.QuietHours {
+		if cfg.QuietHours[i].MinPriority == 0 {
+			cfg.QuietHours[i].MinPriority = 5
+		}
+	}
+	for _, alert := range cfg.Alerts {
+		if alert.QuietHours != nil && alert.QuietHours.MinPriority == 0 {
+			alert.QuietHours.MinPriority = 5
+		}
+	}
+	if cfg.Daemon.Interval == "" {
+		cfg.Daemon.Interval = "5m"
+	}
+	if cfg.Email.TLS == "" {
+		cfg.Email.TLS = "starttls"
+	}
+	if cfg.Email.Port == 0 {
+		cfg.Email.Port = 587
+		if cfg.Email.TLS == "implicit" {
+			cfg.Email.Port = 465
+		}
+	}
 
 	// Validate
 	if err := cfg.Validate(); err != nil {
@@ -69,6 +809,73 @@ func Load(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// setConditionDefaults fills in defaults for a condition and its children.
+// Compound conditions get their operator as type so that notifiers can
+// report it like any other type.
+func setConditionDefaults(c *ConditionConfig) {
+	if c.IsIndicator() && c.Interval == "" {
+		c.Interval = "1d"
+	}
+	if c.IsVolume() && c.Length == 0 {
+		c.Length = 20
+	}
+	switch c.Type {
+	case "trailing_stop", "drawdown":
+		if c.Reset == "" {
+			c.Reset = "recover"
+		}
+	case "unusual_volume":
+		if c.Period == "" {
+			c.Period = "1h"
+		}
+	case "sma_cross", "ema_cross":
+		if c.Direction == "" {
+			c.Direction = "both"
+		}
+	case "macd":
+		if c.Fast == 0 && c.Slow == 0 {
+			c.Fast, c.Slow = 12, 26
+		}
+		if c.Signal == 0 {
+			c.Signal = 9
+		}
+		if c.Direction == "" {
+			c.Direction = "both"
+		}
+	case "rsi", "atr":
+		if c.Length == 0 {
+			c.Length = 14
+		}
+	case "bollinger":
+		if c.Length == 0 {
+			c.Length = 20
+		}
+		if c.Deviations == 0 {
+			c.Deviations = 2
+		}
+		if c.Direction == "" {
+			c.Direction = "outside"
+		}
+	}
+
+	op := c.Operator()
+	if op == "" {
+		return
+	}
+	if c.Type == "" {
+		c.Type = op
+	}
+	for i := range c.All {
+		setConditionDefaults(&c.All[i])
+	}
+	for i := range c.Any {
+		setConditionDefaults(&c.Any[i])
+	}
+	if c.Not != nil {
+		setConditionDefaults(c.Not)
+	}
+}
+
 // expandEnvVars replaces ${VAR} patterns with environment variable values
 func expandEnvVars(content string) string {
 	re := regexp.MustCompile(`\$\{([^}]+)\}`)
@@ -83,14 +890,134 @@ func expandEnvVars(content string) string {
 
 // Validate checks the configuration for errors
 func (c *Config) Validate() error {
-	if c.Ntfy.Server == "" {
-		return fmt.Errorf("ntfy.server is required")
+	if !c.Ntfy.Enabled() && !c.Slack.Enabled() && !c.Discord.Enabled() && !c.Email.Enabled() &&
+		!c.Telegram.Enabled() && !c.Matrix.Enabled() && !c.Webhook.Enabled() && !c.Exec.Enabled() {
+		return fmt.Errorf("at least one notifier (ntfy, slack, discord, email, telegram, matrix, webhook, exec) is required")
+	}
+
+	if c.Ntfy.Enabled() {
+		if c.Ntfy.Server == "" {
+			return fmt.Errorf("ntfy.server is required")
+		}
+		if c.Ntfy.Topic == "" {
+			return fmt.Errorf("ntfy.topic is required")
+		}
+		if c.Ntfy.Priority < 1 || c.Ntfy.Priority > 5 {
+			return fmt.Errorf("ntfy.priority must be between 1 and 5")
+		}
+		if c.Ntfy.Icon != "" {
+			if err := validateURL(c.Ntfy.Icon); err != nil {
+				return fmt.Errorf("ntfy.icon: %w", err)
+			}
+		}
+		if c.Ntfy.Click != "" && c.Ntfy.Click != "quote" && c.Ntfy.Click != "none" {
+			if err := validateURL(c.Ntfy.Click); err != nil {
+				return fmt.Errorf("ntfy.click: %w", err)
+			}
+		}
+	}
+
+	if c.Email.Enabled() {
+		if c.Email.From == "" {
+			return fmt.Errorf("email.from is required")
+		}
+		if len(c.Email.To) == 0 {
+			return fmt.Errorf("email.to is required")
+		}
+		switch c.Email.TLS {
+		case "starttls", "implicit", "none":
+		default:
+			return fmt.Errorf("email.tls must be starttls, implicit, or none")
+		}
 	}
-	if c.Ntfy.Topic == "" {
-		return fmt.Errorf("ntfy.topic is required")
+
+	if c.Telegram.Enabled() && c.Telegram.MaxRetries < 0 {
+		return fmt.Errorf("telegram.max_retries must not be negative")
+	}
+
+	if c.Matrix.Enabled() {
+		if c.Matrix.AccessToken == "" {
+			return fmt.Errorf("matrix.access_token is required")
+		}
+		if c.Matrix.MaxRetries < 0 {
+			return fmt.Errorf("matrix.max_retries must not be negative")
+		}
 	}
-	if c.Ntfy.Priority < 1 || c.Ntfy.Priority > 5 {
-		return fmt.Errorf("ntfy.priority must be between 1 and 5")
+
+	if c.Webhook.Enabled() {
+		if c.Webhook.Secret == "" {
+			return fmt.Errorf("webhook.secret is required with webhook.url, so receivers can verify requests")
+		}
+		if c.Webhook.MaxRetries < 0 {
+			return fmt.Errorf("webhook.max_retries must not be negative")
+		}
+		if _, err := time.ParseDuration(c.Webhook.RetryDelay); err != nil {
+			return fmt.Errorf("webhook.retry_delay: %w", err)
+		}
+	}
+
+	if c.Exec.Enabled() {
+		if c.Exec.Command[0] == "" {
+			return fmt.Errorf("exec.command must start with a program")
+		}
+		if d, err := time.ParseDuration(c.Exec.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("exec.timeout must be a positive duration")
+		}
+	}
+
+	for _, d := range []struct{ name, value string }{
+		{"outbox.max_age", c.Outbox.MaxAge},
+		{"outbox.backoff", c.Outbox.Backoff},
+		{"outbox.max_backoff", c.Outbox.MaxBackoff},
+	} {
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			return fmt.Errorf("%s must be a positive duration", d.name)
+		}
+	}
+
+	switch c.Grouping.Mode {
+	case "none", "run", "group":
+	default:
+		return fmt.Errorf("grouping.mode must be none, run, or group")
+	}
+	if c.Grouping.MaxSize < 2 {
+		return fmt.Errorf("grouping.max_size must be at least 2")
+	}
+
+	names := make(map[string]bool)
+	for i, d := range c.Digests {
+		if err := c.validateDigest(d); err != nil {
+			return fmt.Errorf("digests[%d]: %w", i, err)
+		}
+		if names[d.Name] {
+			return fmt.Errorf("digests[%d]: duplicate name %q", i, d.Name)
+		}
+		names[d.Name] = true
+	}
+
+	for i, q := range c.QuietHours {
+		if err := c.validateQuietHours(q); err != nil {
+			return fmt.Errorf("quiet_hours[%d]: %w", i, err)
+		}
+	}
+
+	if v, err := period.Parse(c.History.Retention); err != nil || v <= 0 {
+		return fmt.Errorf("history.retention must be a positive duration like \"7d\"")
+	}
+
+	if d, err := time.ParseDuration(c.Daemon.Interval); err != nil || d <= 0 {
+		return fmt.Errorf("daemon.interval must be a positive duration")
+	}
+	if c.Daemon.Listen != "" && c.Daemon.Token == "" {
+		return fmt.Errorf("daemon.token is required when daemon.listen is set")
+	}
+	if c.Daemon.PublicURL != "" {
+		if c.Daemon.Listen == "" {
+			return fmt.Errorf("daemon.listen is required when daemon.public_url is set")
+		}
+		if err := validateURL(c.Daemon.PublicURL); err != nil {
+			return fmt.Errorf("daemon.public_url: %w", err)
+		}
 	}
 
 	if len(c.Alerts) == 0 {
@@ -104,27 +1031,355 @@ func (c *Config) Validate() error {
 		if len(alert.Conditions) == 0 {
 			return fmt.Errorf("alerts[%d].conditions is required", i)
 		}
+		if c.Telegram.Enabled() && c.Telegram.ChatID == "" && alert.TelegramChatID == "" {
+			return fmt.Errorf("alerts[%d]: telegram_chat_id is required when telegram.chat_id is not set", i)
+		}
+		if c.Matrix.Enabled() && c.Matrix.RoomID == "" && alert.MatrixRoomID == "" {
+			return fmt.Errorf("alerts[%d]: matrix_room_id is required when matrix.room_id is not set", i)
+		}
+		if err := c.validateNtfyOverride(alert.Ntfy); err != nil {
+			return fmt.Errorf("alerts[%d].ntfy: %w", i, err)
+		}
+		if alert.QuietHours != nil {
+			if err := c.validateQuietHours(*alert.QuietHours); err != nil {
+				return fmt.Errorf("alerts[%d].quiet_hours: %w", i, err)
+			}
+		}
 
 		for j, cond := range alert.Conditions {
-			if err := validateCondition(cond); err != nil {
-				return fmt.Errorf("alerts[%d].conditions[%d]: %w", i, j, err)
+			if err := validateCondition(cond, fmt.Sprintf("alerts[%d].conditions[%d]", i, j), true); err != nil {
+				return err
+			}
+			if err := c.validateNtfyOverride(cond.Ntfy); err != nil {
+				return fmt.Errorf("alerts[%d].conditions[%d].ntfy: %w", i, j, err)
 			}
+			if needed := cond.HistoryNeeded(); needed > c.History.RetentionPeriod() {
+				return fmt.Errorf("alerts[%d].conditions[%d]: needs %s of price history; set history.retention to at least that",
+					i, j, formatDays(needed))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateNtfyOverride(o *NtfyOverride) error {
+	if o == nil {
+		return nil
+	}
+	// A bare priority is also used by quiet hours, so it's allowed without ntfy
+	onlyPriority := o.Server == "" && o.Topic == "" && o.Username == "" && o.Password == "" &&
+		o.Token == "" && len(o.Tags) == 0 && o.Icon == ""
+	if !c.Ntfy.Enabled() && !onlyPriority {
+		return fmt.Errorf("overrides require the ntfy notifier to be configured")
+	}
+	if o.Priority != 0 && (o.Priority < 1 || o.Priority > 5) {
+		return fmt.Errorf("priority must be between 1 and 5")
+	}
+	if o.Server != "" {
+		if err := validateURL(o.Server); err != nil {
+			return fmt.Errorf("server: %w", err)
+		}
+	}
+	if o.Icon != "" {
+		if err := validateURL(o.Icon); err != nil {
+			return fmt.Errorf("icon: %w", err)
+		}
+	}
+	if strings.Contains(o.Topic, "/") {
+		return fmt.Errorf("topic must not contain '/'")
+	}
+	if (o.Username == "") != (o.Password == "") {
+		return fmt.Errorf("username and password must be set together")
+	}
+	return nil
+}
+
+func (c *Config) validateDigest(d DigestConfig) error {
+	switch d.Schedule {
+	case "daily":
+	case "weekly":
+		if _, ok := ParseWeekday(d.Weekday); !ok {
+			return fmt.Errorf("invalid weekday %q", d.Weekday)
+		}
+	default:
+		return fmt.Errorf("schedule must be daily or weekly")
+	}
+	if _, err := time.Parse("15:04", d.At); err != nil {
+		return fmt.Errorf("at must be a time of day like \"08:00\"")
+	}
+	if d.Timezone != "" {
+		if _, err := time.LoadLocation(d.Timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+	}
+	if d.Notifier != "" && !c.notifierEnabled(d.Notifier) {
+		return fmt.Errorf("notifier %q is not configured", d.Notifier)
+	}
+	// Digests aren't tied to an alert, so they go to the default chat or room
+	if (d.Notifier == "" || d.Notifier == "telegram") && c.Telegram.Enabled() && c.Telegram.ChatID == "" {
+		return fmt.Errorf("telegram.chat_id is required to send digests through telegram (or set notifier)")
+	}
+	if (d.Notifier == "" || d.Notifier == "matrix") && c.Matrix.Enabled() && c.Matrix.RoomID == "" {
+		return fmt.Errorf("matrix.room_id is required to send digests through matrix (or set notifier)")
+	}
+	for _, field := range d.Include {
+		valid := false
+		for _, f := range DigestFields {
+			valid = valid || f == field
+		}
+		if !valid {
+			return fmt.Errorf("invalid include %q (must be one of %s)", field, strings.Join(DigestFields, ", "))
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateQuietHours(q QuietHours) error {
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return fmt.Errorf("start must be a time of day like \"22:00\"")
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return fmt.Errorf("end must be a time of day like \"07:00\"")
+	}
+	if start.Equal(end) {
+		return fmt.Errorf("start and end must differ")
+	}
+	if q.Timezone != "" {
+		if _, err := time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+	}
+	if q.MinPriority < 1 || q.MinPriority > 5 {
+		return fmt.Errorf("min_priority must be between 1 and 5")
+	}
+	for _, n := range q.Notifiers {
+		if !c.notifierEnabled(n) {
+			return fmt.Errorf("notifier %q is not configured", n)
+		}
+	}
+	return nil
+}
+
+// Priority returns the priority of alerts raised by cond: the ntfy priority
+// after per-alert and per-condition overrides, 1 (min) to 5 (max)
+func (c *Config) Priority(alert AlertConfig, cond ConditionConfig) int {
+	return c.Ntfy.WithOverrides(alert.Ntfy, cond.Ntfy).Priority
+}
+
+// notifierEnabled reports whether the notifier with the given name is configured
+func (c *Config) notifierEnabled(name string) bool {
+	switch name {
+	case "ntfy":
+		return c.Ntfy.Enabled()
+	case "slack":
+		return c.Slack.Enabled()
+	case "discord":
+		return c.Discord.Enabled()
+	case "email":
+		return c.Email.Enabled()
+	case "telegram":
+		return c.Telegram.Enabled()
+	case "matrix":
+		return c.Matrix.Enabled()
+	case "webhook":
+		return c.Webhook.Enabled()
+	case "exec":
+		return c.Exec.Enabled()
+	}
+	return false
+}
+
+// ParseWeekday parses a lowercase or capitalized English day name
+func ParseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), name) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// validateURL checks that s is an absolute http(s) URL
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an http(s) URL", s)
+	}
+	return nil
+}
+
+// validateCondition checks a condition and, for compound conditions, its
+// children. Errors are prefixed with the condition's path, e.g.
+// "alerts[0].conditions[1].all[2]". Only top-level conditions may carry
+// messages and notification settings.
+func validateCondition(c ConditionConfig, path string, top bool) error {
+	if err := validateConditionFields(c, top); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	op := c.Operator()
+	for i, child := range c.Children() {
+		childPath := fmt.Sprintf("%s.%s[%d]", path, op, i)
+		if op == "not" {
+			childPath = path + ".not"
+		}
+		if err := validateCondition(child, childPath, false); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func validateCondition(c ConditionConfig) error {
+// validateConditionFields checks a single condition node, without its children
+func validateConditionFields(c ConditionConfig, top bool) error {
+	if !top {
+		for _, f := range []struct{ name, value string }{
+			{"message", c.Message},
+			{"title", c.Title},
+			{"cooldown", c.Cooldown},
+			{"repeat_every", c.RepeatEvery},
+			{"trigger_on", c.TriggerOn},
+		} {
+			if f.value != "" {
+				return fmt.Errorf("%s is only supported on top-level conditions", f.name)
+			}
+		}
+		if c.Ntfy != nil {
+			return fmt.Errorf("ntfy is only supported on top-level conditions")
+		}
+	}
+
+	if op := c.Operator(); op != "" {
+		set := 0
+		if c.All != nil {
+			set++
+		}
+		if c.Any != nil {
+			set++
+		}
+		if c.Not != nil {
+			set++
+		}
+		if set > 1 {
+			return fmt.Errorf("only one of all, any and not may be set")
+		}
+		if c.Type != "" && c.Type != op {
+			return fmt.Errorf("type %q cannot be combined with %s", c.Type, op)
+		}
+		if op != "not" && len(c.Children()) == 0 {
+			return fmt.Errorf("%s needs at least one condition", op)
+		}
+		if c.Value != 0 || c.Period != "" || c.ResetBand != "" {
+			return fmt.Errorf("value, period and reset_band belong on the conditions inside %s", op)
+		}
+		return validateConditionSettings(c)
+	}
+
 	validTypes := map[string]bool{
-		"above":           true,
-		"below":           true,
-		"percent_change":  true,
-		"absolute_change": true,
+		"above":             true,
+		"below":             true,
+		"percent_change":    true,
+		"absolute_change":   true,
+		"expression":        true,
+		"sma_cross":         true,
+		"ema_cross":         true,
+		"rsi":               true,
+		"bollinger":         true,
+		"macd":              true,
+		"atr":               true,
+		"volume_spike":      true,
+		"unusual_volume":    true,
+		"new_52w_high":      true,
+		"new_52w_low":       true,
+		"near_52w_high":     true,
+		"new_all_time_high": true,
+		"trailing_stop":     true,
+		"drawdown":          true,
 	}
 
 	if !validTypes[c.Type] {
-		return fmt.Errorf("invalid type %q (must be above, below, percent_change, or absolute_change)", c.Type)
+		return fmt.Errorf("invalid type %q (must be above, below, percent_change, absolute_change, expression, sma_cross, ema_cross, rsi, bollinger, macd, atr, volume_spike, unusual_volume, new_52w_high, new_52w_low, near_52w_high, new_all_time_high, trailing_stop, or drawdown, or use all, any or not)", c.Type)
+	}
+
+	if c.IsIndicator() {
+		if err := validateIndicator(c); err != nil {
+			return err
+		}
+		return validateConditionSettings(c)
+	}
+	if c.Fast != 0 || c.Slow != 0 || c.Signal != 0 || c.Deviations != 0 || c.Interval != "" || c.Direction != "" {
+		return fmt.Errorf("fast, slow, signal, deviations, interval and direction are only used by indicator conditions")
+	}
+
+	if c.IsVolume() {
+		if c.Value <= 0 {
+			return fmt.Errorf("value must be a positive multiple of the average volume, e.g. 3")
+		}
+		if c.Length < 1 {
+			return fmt.Errorf("length must be a positive number of days")
+		}
+		if c.Type == "volume_spike" && c.Period != "" {
+			return fmt.Errorf("period isn't used by volume_spike conditions")
+		}
+		if c.Type == "unusual_volume" {
+			if v, err := period.Parse(c.Period); err != nil || v <= 0 {
+				return fmt.Errorf("period must be a positive duration like \"1h\"")
+			}
+		}
+		if c.ResetBand != "" {
+			return fmt.Errorf("reset_band isn't used by %s conditions", c.Type)
+		}
+		return validateConditionSettings(c)
+	}
+	if c.Length != 0 {
+		return fmt.Errorf("length is only used by indicator and volume conditions")
+	}
+
+	if c.Type == "trailing_stop" || c.Type == "drawdown" {
+		if err := validateTrailing(c); err != nil {
+			return err
+		}
+		return validateConditionSettings(c)
+	}
+	if c.Trail != "" || c.Activation != 0 || c.Reset != "" {
+		return fmt.Errorf("trail, activation and reset are only used by trailing_stop and drawdown conditions")
+	}
+
+	if c.IsRecord() {
+		if c.Type == "near_52w_high" {
+			if c.Value <= 0 || c.Value >= 100 {
+				return fmt.Errorf("value must be a percentage between 0 and 100")
+			}
+		} else if c.Value != 0 {
+			return fmt.Errorf("value isn't used by %s conditions", c.Type)
+		}
+		if c.Period != "" || c.ResetBand != "" {
+			return fmt.Errorf("period and reset_band aren't used by %s conditions", c.Type)
+		}
+		return validateConditionSettings(c)
+	}
+
+	if c.Type == "expression" {
+		if c.Expression == "" {
+			return fmt.Errorf("expression is required for expression conditions")
+		}
+		if _, err := expr.Parse(c.Expression); err != nil {
+			return fmt.Errorf("expression: %w", err)
+		}
+		if c.Value != 0 || c.Period != "" || c.ResetBand != "" {
+			return fmt.Errorf("value, period and reset_band aren't used by expression conditions")
+		}
+		return validateConditionSettings(c)
+	}
+	if c.Expression != "" {
+		return fmt.Errorf("expression is only used by expression conditions")
 	}
 
 	if c.Value <= 0 {
@@ -135,9 +1390,167 @@ func validateCondition(c ConditionConfig) error {
 		return fmt.Errorf("period is required for %s conditions", c.Type)
 	}
 
+	if c.ResetBand != "" {
+		if c.Type != "above" && c.Type != "below" {
+			return fmt.Errorf("reset_band is only supported on above and below conditions")
+		}
+		band, err := c.resetBand()
+		if err != nil {
+			return err
+		}
+		if band <= 0 || band >= c.Value {
+			return fmt.Errorf("reset_band must be positive and smaller than the threshold")
+		}
+	}
+
+	return validateConditionSettings(c)
+}
+
+// validateIndicator checks the settings of an indicator condition
+func validateIndicator(c ConditionConfig) error {
+	if v, err := period.Parse(c.Interval); err != nil || v <= 0 {
+		return fmt.Errorf("interval must be a positive duration like \"1h\" or \"1d\"")
+	}
+	if c.Period != "" || c.ResetBand != "" {
+		return fmt.Errorf("period and reset_band aren't used by %s conditions", c.Type)
+	}
+
+	usesFastSlow := c.IsCross() || c.Type == "macd"
+	if !usesFastSlow && (c.Fast != 0 || c.Slow != 0) {
+		return fmt.Errorf("fast and slow are only used by sma_cross, ema_cross and macd conditions")
+	}
+	if c.Type != "macd" && c.Signal != 0 {
+		return fmt.Errorf("signal is only used by macd conditions")
+	}
+	if usesFastSlow && c.Length != 0 {
+		return fmt.Errorf("length isn't used by %s conditions; use fast and slow", c.Type)
+	}
+	if c.Type != "bollinger" && c.Deviations != 0 {
+		return fmt.Errorf("deviations is only used by bollinger conditions")
+	}
+
+	directions := []string{"above", "below"}
+	switch c.Type {
+	case "sma_cross", "ema_cross", "macd":
+		if c.Fast < 1 || c.Slow < 1 {
+			return fmt.Errorf("fast and slow must be positive numbers of bars")
+		}
+		if c.Fast >= c.Slow {
+			return fmt.Errorf("fast must be smaller than slow")
+		}
+		if c.Type == "macd" && c.Signal < 1 {
+			return fmt.Errorf("signal must be a positive number of bars")
+		}
+		if c.Value != 0 {
+			return fmt.Errorf("value isn't used by %s conditions", c.Type)
+		}
+		directions = []string{"up", "down", "both"}
+
+	case "rsi", "atr":
+		if c.Length < 1 {
+			return fmt.Errorf("length must be a positive number of bars")
+		}
+		if c.Value <= 0 {
+			return fmt.Errorf("value must be positive")
+		}
+		if c.Type == "rsi" && c.Value >= 100 {
+			return fmt.Errorf("value must be below 100, the RSI's maximum")
+		}
+
+	case "bollinger":
+		if c.Length < 2 {
+			return fmt.Errorf("length must be at least 2 bars")
+		}
+		if c.Deviations <= 0 {
+			return fmt.Errorf("deviations must be positive")
+		}
+		if c.Value != 0 {
+			return fmt.Errorf("value isn't used by bollinger conditions")
+		}
+		directions = []string{"above", "below", "outside"}
+	}
+
+	for _, d := range directions {
+		if c.Direction == d {
+			return nil
+		}
+	}
+	return fmt.Errorf("direction must be one of %s", strings.Join(directions, ", "))
+}
+
+// validateTrailing checks the settings of a trailing stop or drawdown condition
+func validateTrailing(c ConditionConfig) error {
+	if c.Type == "trailing_stop" {
+		if c.Trail == "" {
+			return fmt.Errorf("trail is required for trailing_stop conditions, e.g. \"8%%\" or 5000")
+		}
+		trail, percent, err := parseAmount(c.Trail)
+		if err != nil || trail <= 0 || (percent && trail >= 100) {
+			return fmt.Errorf("trail must be a positive amount like 5000 or a percentage below 100 like \"8%%\"")
+		}
+		if c.Value != 0 {
+			return fmt.Errorf("value isn't used by trailing_stop conditions; set trail instead")
+		}
+	} else {
+		if c.Value <= 0 || c.Value >= 100 {
+			return fmt.Errorf("value must be a percentage between 0 and 100")
+		}
+		if c.Trail != "" {
+			return fmt.Errorf("trail is only used by trailing_stop conditions")
+		}
+	}
+
+	if c.Activation < 0 {
+		return fmt.Errorf("activation must not be negative")
+	}
+	switch c.Reset {
+	case "recover", "new_high", "never":
+	default:
+		return fmt.Errorf("reset must be recover, new_high, or never")
+	}
+	if c.Period != "" || c.ResetBand != "" {
+		return fmt.Errorf("period and reset_band aren't used by %s conditions", c.Type)
+	}
 	return nil
 }
 
+// validateConditionSettings checks the trigger and message settings shared
+// by leaf and compound conditions
+func validateConditionSettings(c ConditionConfig) error {
+	switch c.TriggerOn {
+	case "", "level", "cross", "first_seen":
+	default:
+		return fmt.Errorf("trigger_on must be level, cross, or first_seen")
+	}
+
+	for _, d := range []struct{ name, value string }{
+		{"cooldown", c.Cooldown},
+		{"repeat_every", c.RepeatEvery},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := period.Parse(d.value); err != nil || v <= 0 {
+			return fmt.Errorf("%s must be a positive duration like \"30m\" or \"1d\"", d.name)
+		}
+	}
+
+	if err := message.Validate(c.Message); err != nil {
+		return fmt.Errorf("message: %w", err)
+	}
+	if err := message.Validate(c.Title); err != nil {
+		return fmt.Errorf("title: %w", err)
+	}
+
+	return nil
+}
+
+// formatDays formats a duration as whole days, rounding up, e.g. "201d"
+func formatDays(d time.Duration) string {
+	day := 24 * time.Hour
+	return fmt.Sprintf("%dd", (d+day-1)/day)
+}
+
 // GetUniqueTickers returns a deduplicated list of all tickers in the config
 func (c *Config) GetUniqueTickers() []string {
 	seen := make(map[string]bool)
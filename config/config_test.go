@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, yaml string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestExpressionWindowsNeedRetention(t *testing.T) {
+	const alert = `
+ntfy:
+  server: https://ntfy.sh
+  topic: alerts
+alerts:
+  - ticker: AAPL
+    conditions:
+      - type: expression
+        expression: 'price > 100 || change("30d") > 10'
+`
+
+	_, err := load(t, alert)
+	if err == nil || !strings.Contains(err.Error(), "needs 30d of price history") {
+		t.Fatalf("default retention: got %v, want an error about 30d of history", err)
+	}
+
+	cfg, err := load(t, alert+"history:\n  retention: 30d\n")
+	if err != nil {
+		t.Fatalf("30d retention: %v", err)
+	}
+	if got, want := cfg.HistoryNeeded("AAPL"), 30*24*time.Hour; got != want {
+		t.Errorf("HistoryNeeded = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookNeedsSecret(t *testing.T) {
+	const webhook = `
+webhook:
+  url: https://example.com/hook
+alerts:
+  - ticker: AAPL
+    conditions:
+      - type: above
+        value: 200
+`
+
+	_, err := load(t, webhook)
+	if err == nil || !strings.Contains(err.Error(), "webhook.secret is required") {
+		t.Fatalf("without a secret: got %v, want webhook.secret required", err)
+	}
+	if _, err := load(t, strings.Replace(webhook, "url:", "secret: s3cret\n  url:", 1)); err != nil {
+		t.Fatalf("with a secret: %v", err)
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{`price > "x"`, `alerts[0].conditions[0]: expression: column 9: strings are only allowed as function windows`},
+		{`rsi(14) > 70`, `expression: column 1: unknown function "rsi"`},
+		{`abs(1, 2) > 1`, `expression: column 6: abs takes 1 argument(s)`},
+		{`change("1y") > 1`, `expression: column 8: change needs a duration like "24h" or "7d", got "1y"`},
+		{`price`, `expression: expression must be a comparison or boolean, not a number`},
+	}
+
+	for _, tt := range tests {
+		_, err := load(t, `
+ntfy:
+  server: https://ntfy.sh
+  topic: alerts
+alerts:
+  - ticker: AAPL
+    conditions:
+      - type: expression
+        expression: '`+tt.expression+`'
+`)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error containing %s", tt.expression, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/callback"
+)
+
+// runDaemon checks prices every daemon.interval until interrupted, serving
+// notification action callbacks if daemon.listen is set
+func (r *runner) runDaemon() error {
+	interval, err := time.ParseDuration(r.cfg.Daemon.Interval)
+	if err != nil {
+		return fmt.Errorf("parsing daemon.interval: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var srv *http.Server
+	if r.cfg.Daemon.Listen != "" {
+		srv = &http.Server{
+			Addr:              r.cfg.Daemon.Listen,
+			Handler:           callback.NewServer(r.st, r.cfg.Daemon.Token),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			log.Printf("Callback server listening on %s", r.cfg.Daemon.Listen)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Callback server failed: %v", err)
+				stop()
+			}
+		}()
+	}
+
+	log.Printf("Checking prices every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.check(); err != nil {
+			log.Printf("Check failed: %v", err)
+		}
+		if err := r.sendDigests(false, nil); err != nil {
+			log.Printf("Sending digests failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Shutting down")
+			if srv != nil {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				return srv.Shutdown(shutdownCtx)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
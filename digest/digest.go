@@ -0,0 +1,185 @@
+package digest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/state"
+)
+
+// Digest summarizes watched tickers on a daily or weekly schedule
+type Digest struct {
+	cfg config.DigestConfig
+	loc *time.Location
+}
+
+// New creates a digest. The config is expected to have been validated by
+// config.Load.
+func New(cfg config.DigestConfig) *Digest {
+	return &Digest{
+		cfg: cfg,
+		loc: cfg.Location(),
+	}
+}
+
+// Name identifies the digest in state and logs
+func (d *Digest) Name() string {
+	return d.cfg.Name
+}
+
+// Notifier returns the name of the notifier to send through, or "" for all
+func (d *Digest) Notifier() string {
+	return d.cfg.Notifier
+}
+
+// Due reports whether a scheduled send has passed since last
+func (d *Digest) Due(last, now time.Time) bool {
+	return last.Before(d.scheduled(now))
+}
+
+// scheduled returns the most recent scheduled send at or before now
+func (d *Digest) scheduled(now time.Time) time.Time {
+	at, _ := time.Parse("15:04", d.cfg.At)
+
+	local := now.In(d.loc)
+	t := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, d.loc)
+	if t.After(local) {
+		t = t.AddDate(0, 0, -1)
+	}
+
+	if d.cfg.Schedule == "weekly" {
+		weekday, _ := config.ParseWeekday(d.cfg.Weekday)
+		for t.Weekday() != weekday {
+			t = t.AddDate(0, 0, -1)
+		}
+	}
+
+	return t
+}
+
+// Build renders the digest title and message from price history and the
+// alert definitions
+func (d *Digest) Build(alertCfgs []config.AlertConfig, st *state.State, now time.Time) (string, string) {
+	title := d.cfg.Title
+	if title == "" {
+		title = "Daily digest"
+		if d.cfg.Schedule == "weekly" {
+			title = "Weekly digest"
+		}
+	}
+
+	var lines []string
+	for _, ticker := range d.tickers(alertCfgs) {
+		lines = append(lines, d.line(ticker, alertCfgs, st, now))
+	}
+
+	return title, strings.Join(lines, "\n")
+}
+
+// tickers returns the configured tickers, defaulting to every alerted ticker
+func (d *Digest) tickers(alertCfgs []config.AlertConfig) []string {
+	if len(d.cfg.Tickers) > 0 {
+		tickers := make([]string, 0, len(d.cfg.Tickers))
+		for _, t := range d.cfg.Tickers {
+			tickers = append(tickers, strings.ToUpper(t))
+		}
+		return tickers
+	}
+
+	cfg := config.Config{Alerts: alertCfgs}
+	return cfg.GetUniqueTickers()
+}
+
+// line summarizes one ticker, e.g.
+// "Bitcoin: $97000.00 · 24h +1.2% · 7d -3.4% · nearest above $100000.00 (+3.1%)"
+func (d *Digest) line(ticker string, alertCfgs []config.AlertConfig, st *state.State, now time.Time) string {
+	name := ticker
+	for _, a := range alertCfgs {
+		if strings.EqualFold(a.Ticker, ticker) && a.Name != "" {
+			name = a.Name
+			break
+		}
+	}
+
+	record, ok := st.Prices[ticker]
+	if !ok {
+		return fmt.Sprintf("%s: no price data yet", name)
+	}
+	price := record.Price
+
+	var parts []string
+	for _, field := range d.cfg.Include {
+		switch field {
+		case "price":
+			parts = append(parts, fmt.Sprintf("$%.2f", price))
+		case "change_24h":
+			parts = append(parts, "24h "+changeText(st, ticker, price, 24*time.Hour, now))
+		case "change_7d":
+			parts = append(parts, "7d "+changeText(st, ticker, price, 7*24*time.Hour, now))
+		case "nearest_threshold":
+			if text := nearestThreshold(ticker, price, alertCfgs); text != "" {
+				parts = append(parts, text)
+			}
+		}
+	}
+
+	return fmt.Sprintf("%s: %s", name, strings.Join(parts, " · "))
+}
+
+// changeText formats the percent change over window, or "n/a" when the
+// history doesn't reach back far enough
+func changeText(st *state.State, ticker string, price float64, window time.Duration, now time.Time) string {
+	past, ok := priceAt(st.PriceHistory[ticker], now.Add(-window), window/10)
+	if !ok || past == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", (price-past)/past*100)
+}
+
+// priceAt returns the recorded price closest to target, if one is within tolerance
+func priceAt(history []state.PriceRecord, target time.Time, tolerance time.Duration) (float64, bool) {
+	var best *state.PriceRecord
+	var bestDist time.Duration
+	for i := range history {
+		dist := history[i].Timestamp.Sub(target)
+		if dist < 0 {
+			dist = -dist
+		}
+		if best == nil || dist < bestDist {
+			best = &history[i]
+			bestDist = dist
+		}
+	}
+
+	if best == nil || bestDist > tolerance {
+		return 0, false
+	}
+	return best.Price, true
+}
+
+// nearestThreshold describes the closest above/below level for the ticker
+func nearestThreshold(ticker string, price float64, alertCfgs []config.AlertConfig) string {
+	var nearest *config.ConditionConfig
+	for _, a := range alertCfgs {
+		if !strings.EqualFold(a.Ticker, ticker) {
+			continue
+		}
+		for i := range a.Conditions {
+			cond := &a.Conditions[i]
+			if cond.Type != "above" && cond.Type != "below" {
+				continue
+			}
+			if nearest == nil || math.Abs(cond.Value-price) < math.Abs(nearest.Value-price) {
+				nearest = cond
+			}
+		}
+	}
+
+	if nearest == nil || price == 0 {
+		return ""
+	}
+	return fmt.Sprintf("nearest %s (%+.1f%%)", nearest.Describe(), (nearest.Value-price)/price*100)
+}
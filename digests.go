@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/digest"
+	"github.com/vcavallo/asset-alerts/notify"
+)
+
+// pendingDigest is a rendered digest and the notifiers it is due on
+type pendingDigest struct {
+	digest    *digest.Digest
+	title     string
+	message   string
+	notifiers []notify.Notifier
+}
+
+// sendDigests sends every digest that is due and records when each was sent.
+// With force set, the digests in names (or all digests if names is empty)
+// are sent regardless of their schedule and quiet hours.
+func (r *runner) sendDigests(force bool, names []string) error {
+	if force && len(r.cfg.Digests) == 0 {
+		return fmt.Errorf("no digests configured")
+	}
+	for _, name := range names {
+		if !r.hasDigest(name) {
+			return fmt.Errorf("unknown digest %q", name)
+		}
+	}
+
+	now := time.Now()
+
+	r.st.Lock()
+	due, changed := r.dueDigests(force, names, now)
+	r.st.Unlock()
+
+	// Send without holding the lock, so callbacks aren't blocked
+	type result struct {
+		name, notifier string
+	}
+	var sent []result
+	for _, p := range due {
+		if r.dryRun {
+			fmt.Printf("Dry run - would send digest %q:\n%s\n%s\n", p.digest.Name(), p.title, p.message)
+			continue
+		}
+
+		for _, n := range p.notifiers {
+			if err := n.SendMessage(p.title, p.message); err != nil {
+				log.Printf("Failed to send digest %s via %s: %v", p.digest.Name(), n.Name(), err)
+				continue
+			}
+			fmt.Printf("✓ Digest %s sent via %s\n", p.digest.Name(), n.Name())
+			sent = append(sent, result{p.digest.Name(), n.Name()})
+		}
+	}
+
+	if r.verbose {
+		log.Printf("Sent %d digests", len(sent))
+	}
+
+	if r.dryRun || (len(sent) == 0 && !changed) {
+		return nil
+	}
+
+	r.st.Lock()
+	defer r.st.Unlock()
+
+	for _, s := range sent {
+		r.st.SetDigestSent(s.name, s.notifier, now)
+	}
+	if err := r.st.Save(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	return nil
+}
+
+// dueDigests renders the digests due now on at least one notifier. Digests
+// seen for the first time are scheduled from now rather than sent at once,
+// and are reported as a change to save. The caller must hold the state lock.
+func (r *runner) dueDigests(force bool, names []string, now time.Time) ([]pendingDigest, bool) {
+	var due []pendingDigest
+	changed := false
+
+	for _, dc := range r.cfg.Digests {
+		d := digest.New(dc)
+		if !r.digestWanted(d, force, names) {
+			continue
+		}
+
+		var notifiers []notify.Notifier
+		for _, n := range r.notifiers {
+			if d.Notifier() != "" && n.Name() != d.Notifier() {
+				continue
+			}
+			if !force && !r.digestDue(d, n, now) {
+				if _, seen := r.st.DigestSent(d.Name(), n.Name()); !seen {
+					r.st.SetDigestSent(d.Name(), n.Name(), now)
+					changed = true
+				}
+				continue
+			}
+			notifiers = append(notifiers, n)
+		}
+		if len(notifiers) == 0 {
+			continue
+		}
+
+		title, message := d.Build(r.cfg.Alerts, r.st, now)
+		due = append(due, pendingDigest{digest: d, title: title, message: message, notifiers: notifiers})
+	}
+
+	return due, changed
+}
+
+// digestDue reports whether d should be sent through n now: its scheduled
+// time has passed since it was last sent, and quiet hours don't hold it back.
+// Digests have the default ntfy priority.
+func (r *runner) digestDue(d *digest.Digest, n notify.Notifier, now time.Time) bool {
+	last, seen := r.st.DigestSent(d.Name(), n.Name())
+	if !seen || !d.Due(last, now) {
+		return false
+	}
+
+	if until, quiet := r.cfg.QuietUntil(n.Name(), r.cfg.Ntfy.Priority, nil, now); quiet {
+		if r.verbose {
+			log.Printf("Holding digest %s for %s until %s (quiet hours)", d.Name(), n.Name(), until.Format(time.RFC3339))
+		}
+		return false
+	}
+	return true
+}
+
+// digestWanted reports whether d was asked for. Without force, every digest is.
+func (r *runner) digestWanted(d *digest.Digest, force bool, names []string) bool {
+	if !force || len(names) == 0 {
+		return true
+	}
+	for _, name := range names {
+		if name == d.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDigest reports whether a digest with the given name is configured
+func (r *runner) hasDigest(name string) bool {
+	for _, d := range r.cfg.Digests {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
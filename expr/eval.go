@@ -0,0 +1,188 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInsufficientHistory is returned when a function's window reaches
+// further back than the recorded price history
+var ErrInsufficientHistory = errors.New("not enough price history")
+
+// Sample is a recorded price
+type Sample struct {
+	Time  time.Time
+	Price float64
+}
+
+// Env holds the data an expression is evaluated against
+type Env struct {
+	Now     time.Time
+	Price   float64  // current price
+	History []Sample // earlier recorded prices, oldest first
+}
+
+// Eval evaluates the expression. It returns ErrInsufficientHistory if a
+// function needs more history than env has.
+func (x *Expr) Eval(env *Env) (bool, error) {
+	v, err := x.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return v.b, nil
+}
+
+// value is the result of evaluating a node; which field is set depends on its kind
+type value struct {
+	num float64
+	b   bool
+}
+
+// node is a type-checked expression tree node
+type node interface {
+	kind() kind
+	eval(env *Env) (value, error)
+}
+
+type number struct{ value float64 }
+
+func (n *number) kind() kind               { return kindNumber }
+func (n *number) eval(*Env) (value, error) { return value{num: n.value}, nil }
+
+type boolean struct{ value bool }
+
+func (b *boolean) kind() kind               { return kindBool }
+func (b *boolean) eval(*Env) (value, error) { return value{b: b.value}, nil }
+
+type variable struct{ name string }
+
+func (v *variable) kind() kind { return kindNumber }
+
+func (v *variable) eval(env *Env) (value, error) {
+	return value{num: env.Price}, nil
+}
+
+type unary struct {
+	op      string
+	operand node
+}
+
+func (u *unary) kind() kind {
+	return u.operand.kind()
+}
+
+func (u *unary) eval(env *Env) (value, error) {
+	v, err := u.operand.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+	if u.op == "!" {
+		return value{b: !v.b}, nil
+	}
+	return value{num: -v.num}, nil
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (b *binary) kind() kind {
+	switch b.op {
+	case "+", "-", "*", "/", "%":
+		return kindNumber
+	}
+	return kindBool
+}
+
+func (b *binary) eval(env *Env) (value, error) {
+	l, err := b.left.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+
+	// Short-circuit boolean operators so that a missing-history branch
+	// doesn't fail an expression that is already decided
+	switch {
+	case b.op == "&&" && !l.b:
+		return value{b: false}, nil
+	case b.op == "||" && l.b:
+		return value{b: true}, nil
+	}
+
+	r, err := b.right.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch b.op {
+	case "&&", "||":
+		return value{b: r.b}, nil
+	case "+":
+		return value{num: l.num + r.num}, nil
+	case "-":
+		return value{num: l.num - r.num}, nil
+	case "*":
+		return value{num: l.num * r.num}, nil
+	case "/":
+		if r.num == 0 {
+			return value{}, errors.New("division by zero")
+		}
+		return value{num: l.num / r.num}, nil
+	case "%":
+		if r.num == 0 {
+			return value{}, errors.New("division by zero")
+		}
+		return value{num: math.Mod(l.num, r.num)}, nil
+	case "<":
+		return value{b: l.num < r.num}, nil
+	case "<=":
+		return value{b: l.num <= r.num}, nil
+	case ">":
+		return value{b: l.num > r.num}, nil
+	case ">=":
+		return value{b: l.num >= r.num}, nil
+	case "==":
+		return value{b: l == r}, nil
+	case "!=":
+		return value{b: l != r}, nil
+	}
+
+	return value{}, fmt.Errorf("unknown operator %q", b.op)
+}
+
+type call struct {
+	name   string
+	fn     function
+	window window
+	args   []node
+}
+
+func (c *call) kind() kind { return kindNumber }
+
+func (c *call) eval(env *Env) (value, error) {
+	args := make([]float64, 0, len(c.args))
+	for _, arg := range c.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		args = append(args, v.num)
+	}
+
+	var prices []float64
+	if c.window != (window{}) {
+		var err error
+		if prices, err = c.window.prices(env); err != nil {
+			return value{}, fmt.Errorf("%s: %w", c.name, err)
+		}
+	}
+
+	result, err := c.fn.eval(prices, args)
+	if err != nil {
+		return value{}, fmt.Errorf("%s: %w", c.name, err)
+	}
+	return value{num: result}, nil
+}
@@ -0,0 +1,136 @@
+package expr
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// testEnv has prices recorded 48h, 24h, 12h and 1h ago
+func testEnv() *Env {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &Env{
+		Now:   now,
+		Price: 132,
+		History: []Sample{
+			{Time: now.Add(-48 * time.Hour), Price: 100},
+			{Time: now.Add(-24 * time.Hour), Price: 110},
+			{Time: now.Add(-12 * time.Hour), Price: 120},
+			{Time: now.Add(-time.Hour), Price: 130},
+		},
+	}
+}
+
+// evalNumber parses and evaluates a numeric expression, which Parse rejects
+func evalNumber(src string, env *Env) (float64, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return 0, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return 0, err
+	}
+	v, err := n.eval(env)
+	return v.num, err
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{`price`, 132},
+		{`change("24h")`, 20}, // from 110
+		{`change("50h")`, 32}, // from 100, the last price before the window
+		{`change(2)`, 132.0/130*100 - 100},
+		{`ago("12h")`, 120},
+		{`ago("6h")`, 120}, // the last price at or before 6h ago
+		{`ago(5)`, 100},
+		{`sma(3)`, (120 + 130 + 132) / 3.0},
+		{`sma("24h")`, (110 + 120 + 130 + 132) / 4.0},
+		{`ema(3)`, 128.5}, // alpha 0.5: 120, 125, 128.5
+		{`high("24h")`, 132},
+		{`low("24h")`, 110},
+		{`low("48h")`, 100},
+		{`high(2) - low(2)`, 2},
+		{`abs(-5)`, 5},
+		{`abs(change("1h"))`, math.Abs(132.0/130*100 - 100)},
+		{`min(price, 100)`, 100},
+		{`max(price, 100)`, 132},
+		{`max(sma(2), ago(2))`, 131},
+		{`price % 5`, 2},
+	}
+
+	for _, tt := range tests {
+		got, err := evalNumber(tt.src, testEnv())
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    bool
+		wantErr error
+	}{
+		{`price > sma("24h") * 1.05`, true, nil},
+		{`change("24h") < -3`, false, nil},
+		{`price > high("48h") * 0.99 && change("12h") > 5`, true, nil},
+
+		// Windows reaching past the recorded history
+		{`sma(6) > 0`, false, ErrInsufficientHistory},
+		{`change("72h") > 0`, false, ErrInsufficientHistory},
+		// unless the other side already decides the result
+		{`price > 100 || change("72h") > 0`, true, nil},
+		{`price < 100 && change("72h") > 0`, false, nil},
+		{`price > 100 && change("72h") > 0`, false, ErrInsufficientHistory},
+	}
+
+	for _, tt := range tests {
+		x, err := Parse(tt.src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.src, err)
+		}
+		got, err := x.Eval(testEnv())
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Eval(%q) error = %v, want %v", tt.src, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		env  *Env
+		want string
+	}{
+		{`change(6) > 0`, testEnv(), "change: not enough price history"},
+		{`price / (price - 132) > 1`, testEnv(), "division by zero"},
+		{`price % 0 > 1`, testEnv(), "division by zero"},
+		{`change(2) > 0`, &Env{Price: 1, History: []Sample{{Price: 0}}}, "change: division by zero"},
+		{`change("1h") > 0`, &Env{Now: time.Now(), Price: 1}, "change: not enough price history"},
+	}
+
+	for _, tt := range tests {
+		x, err := Parse(tt.src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.src, err)
+		}
+		if _, err := x.Eval(tt.env); err == nil || err.Error() != tt.want {
+			t.Errorf("Eval(%q) error = %v, want %s", tt.src, err, tt.want)
+		}
+	}
+}
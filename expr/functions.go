@@ -0,0 +1,123 @@
+package expr
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// paramKind is the kind of a function parameter
+type paramKind int
+
+const (
+	paramNumber paramKind = iota // any numeric expression
+	paramWindow                  // a literal sample count or duration string
+)
+
+// function is a built-in function. Window functions receive the prices in
+// their window, oldest first and ending with the current price.
+type function struct {
+	params []paramKind
+	eval   func(prices, args []float64) (float64, error)
+}
+
+// functions are the built-ins available to expressions
+var functions = map[string]function{
+	// sma(w): simple moving average
+	"sma": {params: []paramKind{paramWindow}, eval: func(prices, _ []float64) (float64, error) {
+		sum := 0.0
+		for _, p := range prices {
+			sum += p
+		}
+		return sum / float64(len(prices)), nil
+	}},
+	// ema(w): exponential moving average, smoothed over the window's sample count
+	"ema": {params: []paramKind{paramWindow}, eval: func(prices, _ []float64) (float64, error) {
+		alpha := 2 / float64(len(prices)+1)
+		ema := prices[0]
+		for _, p := range prices[1:] {
+			ema = alpha*p + (1-alpha)*ema
+		}
+		return ema, nil
+	}},
+	// change(w): percent change from the start of the window
+	"change": {params: []paramKind{paramWindow}, eval: func(prices, _ []float64) (float64, error) {
+		if prices[0] == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return (prices[len(prices)-1] - prices[0]) / prices[0] * 100, nil
+	}},
+	// ago(w): price at the start of the window
+	"ago": {params: []paramKind{paramWindow}, eval: func(prices, _ []float64) (float64, error) {
+		return prices[0], nil
+	}},
+	// high(w), low(w): highest and lowest price in the window
+	"high": {params: []paramKind{paramWindow}, eval: func(prices, _ []float64) (float64, error) {
+		high := prices[0]
+		for _, p := range prices {
+			high = math.Max(high, p)
+		}
+		return high, nil
+	}},
+	"low": {params: []paramKind{paramWindow}, eval: func(prices, _ []float64) (float64, error) {
+		low := prices[0]
+		for _, p := range prices {
+			low = math.Min(low, p)
+		}
+		return low, nil
+	}},
+	"abs": {params: []paramKind{paramNumber}, eval: func(_, args []float64) (float64, error) {
+		return math.Abs(args[0]), nil
+	}},
+	"min": {params: []paramKind{paramNumber, paramNumber}, eval: func(_, args []float64) (float64, error) {
+		return math.Min(args[0], args[1]), nil
+	}},
+	"max": {params: []paramKind{paramNumber, paramNumber}, eval: func(_, args []float64) (float64, error) {
+		return math.Max(args[0], args[1]), nil
+	}},
+}
+
+// window selects recent prices either by count or by age
+type window struct {
+	samples int           // the last n prices, including the current one
+	period  time.Duration // prices recorded within the period, including the current one
+}
+
+// coverage is how close to the start of a period the oldest sample must be
+// for the period to count as covered, as a fraction of the period
+const coverage = 0.1
+
+// prices returns the window's prices, oldest first, ending with the current price
+func (w window) prices(env *Env) ([]float64, error) {
+	all := make([]float64, 0, len(env.History)+1)
+
+	if w.samples > 0 {
+		if len(env.History)+1 < w.samples {
+			return nil, ErrInsufficientHistory
+		}
+		for _, s := range env.History[len(env.History)-(w.samples-1):] {
+			all = append(all, s.Price)
+		}
+		return append(all, env.Price), nil
+	}
+
+	start := env.Now.Add(-w.period)
+	slack := time.Duration(float64(w.period) * coverage)
+	if len(env.History) == 0 || env.History[0].Time.After(start.Add(slack)) {
+		return nil, ErrInsufficientHistory
+	}
+
+	// Start from the last sample at or before the window start, so that
+	// change and ago compare against the price at that time
+	first := 0
+	for i, s := range env.History {
+		if s.Time.After(start) {
+			break
+		}
+		first = i
+	}
+	for _, s := range env.History[first:] {
+		all = append(all, s.Price)
+	}
+	return append(all, env.Price), nil
+}
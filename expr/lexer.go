@@ -0,0 +1,94 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind classifies lexer tokens
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp // operators and punctuation
+)
+
+// token is a lexeme with its 1-based column in the source
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	col  int
+}
+
+// operators lists multi-character operators before their prefixes
+var operators = []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")", ","}
+
+// lex splits src into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		col := i + 1
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			num, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, errorAt(col, "invalid number %q", src[i:j])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[i:j], num: num, col: col})
+			i = j
+
+		case c == '"' || c == '\'':
+			j := strings.IndexRune(src[i+1:], c)
+			if j < 0 {
+				return nil, errorAt(col, "unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokString, text: src[i+1 : i+1+j], col: col})
+			i += j + 2
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[i:j], col: col})
+			i = j
+
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorAt(col, "unexpected character %q", c)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, col: col})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, col: len(src) + 1}), nil
+}
+
+// errorAt formats an error pointing at a column of the expression
+func errorAt(col int, format string, args ...interface{}) error {
+	return fmt.Errorf("column %d: %s", col, fmt.Sprintf(format, args...))
+}
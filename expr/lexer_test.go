@@ -0,0 +1,71 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []token
+	}{
+		{`price>=1.5`, []token{
+			{kind: tokIdent, text: "price", col: 1},
+			{kind: tokOp, text: ">=", col: 6},
+			{kind: tokNumber, text: "1.5", num: 1.5, col: 8},
+			{kind: tokEOF, col: 11},
+		}},
+		{`change('24h') < -3`, []token{
+			{kind: tokIdent, text: "change", col: 1},
+			{kind: tokOp, text: "(", col: 7},
+			{kind: tokString, text: "24h", col: 8},
+			{kind: tokOp, text: ")", col: 13},
+			{kind: tokOp, text: "<", col: 15},
+			{kind: tokOp, text: "-", col: 17},
+			{kind: tokNumber, text: "3", num: 3, col: 18},
+			{kind: tokEOF, col: 19},
+		}},
+		{`!a_1&&b||c!=d`, []token{
+			{kind: tokOp, text: "!", col: 1},
+			{kind: tokIdent, text: "a_1", col: 2},
+			{kind: tokOp, text: "&&", col: 5},
+			{kind: tokIdent, text: "b", col: 7},
+			{kind: tokOp, text: "||", col: 8},
+			{kind: tokIdent, text: "c", col: 10},
+			{kind: tokOp, text: "!=", col: 11},
+			{kind: tokIdent, text: "d", col: 13},
+			{kind: tokEOF, col: 14},
+		}},
+	}
+
+	for _, tt := range tests {
+		got, err := lex(tt.src)
+		if err != nil {
+			t.Errorf("lex(%q): %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lex(%q) =\n%+v\nwant\n%+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`price > 1..2`, `column 9: invalid number "1..2"`},
+		{`price > 'abc`, `column 9: unterminated string`},
+		{`price # 1`, `column 7: unexpected character '#'`},
+		{`price & 1`, `column 7: unexpected character '&'`},
+	}
+
+	for _, tt := range tests {
+		_, err := lex(tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("lex(%q) error = %v, want %s", tt.src, err, tt.want)
+		}
+	}
+}
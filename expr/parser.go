@@ -0,0 +1,371 @@
+package expr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/period"
+)
+
+// kind is the static type of an expression
+type kind int
+
+const (
+	kindNumber kind = iota
+	kindBool
+)
+
+func (k kind) String() string {
+	if k == kindBool {
+		return "boolean"
+	}
+	return "number"
+}
+
+// Expr is a parsed, type-checked boolean expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses src and checks that it is a well-typed boolean expression
+func Parse(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, errorAt(tok.col, "unexpected %q", tok.text)
+	}
+	if root.kind() != kindBool {
+		return nil, fmt.Errorf("expression must be a comparison or boolean, not a %s", root.kind())
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the expression's source
+func (x *Expr) String() string {
+	return x.src
+}
+
+// Lookback returns the longest duration window in the expression, which is
+// how much recorded history it needs. Sample-count windows aren't included,
+// since how far back they reach depends on how often prices are recorded.
+func (x *Expr) Lookback() time.Duration {
+	return lookback(x.root)
+}
+
+func lookback(n node) time.Duration {
+	switch n := n.(type) {
+	case *unary:
+		return lookback(n.operand)
+	case *binary:
+		return max(lookback(n.left), lookback(n.right))
+	case *call:
+		d := n.window.period
+		for _, arg := range n.args {
+			d = max(d, lookback(arg))
+		}
+		return d
+	}
+	return 0
+}
+
+// parser is a precedence-climbing parser over lexer tokens
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the given operators
+func (p *parser) accept(ops ...string) (token, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return tok, false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			return p.next(), true
+		}
+	}
+	return tok, false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		if tok.kind == tokEOF {
+			return errorAt(tok.col, "expected %q at end of expression", op)
+		}
+		return errorAt(tok.col, "expected %q, found %q", op, tok.text)
+	}
+	return nil
+}
+
+// parseOr: and ("||" and)*
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newBinary(tok, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseAnd: comparison ("&&" comparison)*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newBinary(tok, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseComparison: sum (comparison-operator sum)?
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	tok, ok := p.accept("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if next, chained := p.accept("<", "<=", ">", ">=", "==", "!="); chained {
+		return nil, errorAt(next.col, "comparisons can't be chained; combine them with &&")
+	}
+	return newBinary(tok, left, right)
+}
+
+// parseSum: product (("+" | "-") product)*
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newBinary(tok, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseProduct: unary (("*" | "/" | "%") unary)*
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newBinary(tok, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseUnary: ("!" | "-") unary | primary
+func (p *parser) parseUnary() (node, error) {
+	tok, ok := p.accept("!", "-")
+	if !ok {
+		return p.parsePrimary()
+	}
+
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	want := kindNumber
+	if tok.text == "!" {
+		want = kindBool
+	}
+	if operand.kind() != want {
+		return nil, errorAt(tok.col, "%q needs a %s, not a %s", tok.text, want, operand.kind())
+	}
+	return &unary{op: tok.text, operand: operand}, nil
+}
+
+// parsePrimary: number | "true" | "false" | identifier | call | "(" or ")"
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNumber:
+		return &number{value: tok.num}, nil
+
+	case tokString:
+		return nil, errorAt(tok.col, "strings are only allowed as function windows, e.g. change(\"24h\")")
+
+	case tokIdent:
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case "true", "false":
+			return &boolean{value: tok.text == "true"}, nil
+		case "price":
+			return &variable{name: tok.text}, nil
+		}
+		if _, ok := functions[tok.text]; ok {
+			return nil, errorAt(tok.col, "%s is a function; call it like %s(...)", tok.text, tok.text)
+		}
+		return nil, errorAt(tok.col, "unknown name %q (the only variable is price)", tok.text)
+
+	case tokOp:
+		if tok.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		}
+		return nil, errorAt(tok.col, "unexpected %q", tok.text)
+	}
+
+	return nil, errorAt(tok.col, "unexpected end of expression")
+}
+
+// parseCall parses the arguments of a call to name, whose "(" has been consumed
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, errorAt(name.col, "unknown function %q", name.text)
+	}
+
+	c := &call{name: name.text, fn: fn}
+	for i, param := range fn.params {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		if param == paramWindow {
+			w, err := p.parseWindow(name.text)
+			if err != nil {
+				return nil, err
+			}
+			c.window = w
+			continue
+		}
+
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if arg.kind() != kindNumber {
+			return nil, errorAt(name.col, "%s needs number arguments, not a %s", name.text, arg.kind())
+		}
+		c.args = append(c.args, arg)
+	}
+
+	if tok := p.peek(); tok.kind == tokOp && tok.text == "," {
+		return nil, errorAt(tok.col, "%s takes %d argument(s)", name.text, len(fn.params))
+	}
+	return c, p.expect(")")
+}
+
+// parseWindow parses a window argument: a sample count like 50 or a
+// duration string like "24h" or "7d"
+func (p *parser) parseWindow(fn string) (window, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNumber:
+		n := int(tok.num)
+		if float64(n) != tok.num || n < 1 {
+			return window{}, errorAt(tok.col, "%s needs a whole number of samples, got %s", fn, tok.text)
+		}
+		return window{samples: n}, nil
+
+	case tokString:
+		d, err := period.Parse(tok.text)
+		if err != nil || d <= 0 {
+			return window{}, errorAt(tok.col, "%s needs a duration like \"24h\" or \"7d\", got %q", fn, tok.text)
+		}
+		return window{period: d}, nil
+	}
+
+	return window{}, errorAt(tok.col, "%s needs a window: a sample count like 50 or a duration like \"24h\"", fn)
+}
+
+// newBinary type-checks a binary operation
+func newBinary(tok token, left, right node) (node, error) {
+	switch tok.text {
+	case "&&", "||":
+		if left.kind() != kindBool || right.kind() != kindBool {
+			return nil, errorAt(tok.col, "%q needs booleans on both sides, got %s and %s", tok.text, left.kind(), right.kind())
+		}
+	case "==", "!=":
+		if left.kind() != right.kind() {
+			return nil, errorAt(tok.col, "can't compare a %s with a %s", left.kind(), right.kind())
+		}
+	default:
+		if left.kind() != kindNumber || right.kind() != kindNumber {
+			return nil, errorAt(tok.col, "%q needs numbers on both sides, got %s and %s", tok.text, left.kind(), right.kind())
+		}
+	}
+	return &binary{op: tok.text, left: left, right: right}, nil
+}
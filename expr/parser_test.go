@@ -0,0 +1,120 @@
+package expr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLookback(t *testing.T) {
+	tests := []struct {
+		src  string
+		want time.Duration
+	}{
+		{`price > 100`, 0},
+		{`price / sma(50) > 1.1`, 0},
+		{`change("24h") < -3`, 24 * time.Hour},
+		{`price > low("7d") * 1.05 && change("30d") > 10`, 30 * 24 * time.Hour},
+		{`!(abs(change("2d")) > 5)`, 2 * 24 * time.Hour},
+		{`-ago("12h") < -price`, 12 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		x, err := Parse(tt.src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.src, err)
+		}
+		if got := x.Lookback(); got != tt.want {
+			t.Errorf("Lookback(%q) = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// && binds tighter than ||
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`false && false || true`, true},
+		// ! applies to the operand only
+		{`!true || true`, true},
+		{`!(true || true)`, false},
+		{`!!true`, true},
+		// unary minus binds tighter than * and comparisons
+		{`-2 * 3 == -6`, true},
+		{`-price + 10 == 6`, true},
+		{`-price * -price == 16`, true},
+		{`2 - -3 == 5`, true},
+		// * / % before + -, all left to right
+		{`2 + 3 * 4 == 14`, true},
+		{`10 - 2 - 3 == 5`, true},
+		{`12 / 3 / 2 == 2`, true},
+		{`10 % 4 * 2 == 4`, true},
+		// arithmetic before comparisons before boolean operators
+		{`price + 1 > 4 && price - 1 < 4`, true},
+		{`(price > 3) == true`, true},
+	}
+
+	env := &Env{Price: 4}
+	for _, tt := range tests {
+		x, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := x.Eval(env)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// types
+		{`price`, `expression must be a comparison or boolean, not a number`},
+		{`price > "x"`, `column 9: strings are only allowed as function windows, e.g. change("24h")`},
+		{`price + true > 1`, `column 7: "+" needs numbers on both sides, got number and boolean`},
+		{`price > 1 && 2`, `column 11: "&&" needs booleans on both sides, got boolean and number`},
+		{`price == true`, `column 7: can't compare a number with a boolean`},
+		{`!price`, `column 1: "!" needs a boolean, not a number`},
+		{`-(price > 1)`, `column 1: "-" needs a number, not a boolean`},
+		{`abs(price > 1) > 0`, `column 1: abs needs number arguments, not a boolean`},
+
+		// names and functions
+		{`volume > 1`, `column 1: unknown name "volume" (the only variable is price)`},
+		{`sma > 1`, `column 1: sma is a function; call it like sma(...)`},
+		{`rsi(14) > 70`, `column 1: unknown function "rsi"`},
+		{`abs(1, 2) > 1`, `column 6: abs takes 1 argument(s)`},
+		{`min(price) > 1`, `column 10: expected ",", found ")"`},
+		{`sma() > 1`, `column 5: sma needs a window: a sample count like 50 or a duration like "24h"`},
+		{`sma(price) > 1`, `column 5: sma needs a window: a sample count like 50 or a duration like "24h"`},
+		{`sma(1.5) > 1`, `column 5: sma needs a whole number of samples, got 1.5`},
+		{`sma(0) > 1`, `column 5: sma needs a whole number of samples, got 0`},
+		{`change("1y") > 1`, `column 8: change needs a duration like "24h" or "7d", got "1y"`},
+		{`change("-1h") > 1`, `column 8: change needs a duration like "24h" or "7d", got "-1h"`},
+
+		// structure
+		{`1 < price < 2`, `column 11: comparisons can't be chained; combine them with &&`},
+		{`(price > 1`, `column 11: expected ")" at end of expression`},
+		{`price > 1)`, `column 10: unexpected ")"`},
+		{`price >`, `column 8: unexpected end of expression`},
+		{`price > * 1`, `column 9: unexpected "*"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Parse(%q) error = %v, want %s", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package indicators computes technical indicators from recorded prices
+package indicators
+
+import "time"
+
+// Point is a price at a point in time, with the range traded since the
+// previous point when it is known
+type Point struct {
+	Time      time.Time
+	Price     float64
+	High, Low float64 // 0 if only Price is known
+}
+
+// Bar summarizes the prices recorded within one interval
+type Bar struct {
+	Start                  time.Time
+	Open, High, Low, Close float64
+}
+
+// Resample groups points, oldest first, into bars of the given interval.
+// Bars start at multiples of the interval since the zero time, so daily bars
+// start at midnight UTC. Intervals without points have no bar, so bars skip
+// over market closures. A point's high and low, when known, widen the range
+// of its bar.
+func Resample(points []Point, interval time.Duration) []Bar {
+	var bars []Bar
+
+	for _, p := range points {
+		start := p.Time.Truncate(interval)
+		high, low := p.Price, p.Price
+		if p.High > 0 {
+			high = max(high, p.High)
+		}
+		if p.Low > 0 {
+			low = min(low, p.Low)
+		}
+		if n := len(bars); n > 0 && bars[n-1].Start.Equal(start) {
+			bar := &bars[n-1]
+			bar.High = max(bar.High, high)
+			bar.Low = min(bar.Low, low)
+			bar.Close = p.Price
+			continue
+		}
+		bars = append(bars, Bar{Start: start, Open: p.Price, High: high, Low: low, Close: p.Price})
+	}
+
+	return bars
+}
+
+// Closes returns the closing prices of bars
+func Closes(bars []Bar) []float64 {
+	closes := make([]float64, len(bars))
+	for i, b := range bars {
+		closes[i] = b.Close
+	}
+	return closes
+}
+
+// SMA returns the simple moving average of the last n values. It reports
+// false if there are fewer than n values.
+func SMA(values []float64, n int) (float64, bool) {
+	if n < 1 || len(values) < n {
+		return 0, false
+	}
+
+	sum := 0.0
+	for _, v := range values[len(values)-n:] {
+		sum += v
+	}
+	return sum / float64(n), true
+}
+
+// EMA returns the exponential moving average over n periods, seeded with the
+// SMA of the first n values and smoothed through the rest. It reports false
+// if there are fewer than n values.
+func EMA(values []float64, n int) (float64, bool) {
+	series := emaSeries(values, n)
+	if len(series) == 0 {
+		return 0, false
+	}
+	return series[len(series)-1], true
+}
+
+// emaSeries returns the exponential moving average over n periods at each
+// value from the nth on, seeded like EMA
+func emaSeries(values []float64, n int) []float64 {
+	if n < 1 || len(values) < n {
+		return nil
+	}
+
+	ema, _ := SMA(values[:n], n)
+	series := []float64{ema}
+	alpha := 2 / float64(n+1)
+	for _, v := range values[n:] {
+		ema = alpha*v + (1-alpha)*ema
+		series = append(series, ema)
+	}
+	return series
+}
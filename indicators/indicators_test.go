@@ -0,0 +1,126 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// movingAverageCloses are the closes from StockCharts' moving average
+// example, which tabulates their 10-day SMA and EMA to two decimal places
+var movingAverageCloses = []float64{
+	22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+	22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+	23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+}
+
+// near reports whether got is within tolerance of want, for comparing with
+// reference values published to two decimal places
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance+1e-9
+}
+
+func TestSMA(t *testing.T) {
+	want := []float64{
+		22.22, 22.21, 22.23, 22.26, 22.31, 22.42, 22.61, 22.77, 22.91, 23.08,
+		23.21, 23.38, 23.53, 23.65, 23.71, 23.69, 23.61, 23.51, 23.43, 23.28, 23.13,
+	}
+	for i, w := range want {
+		got, ok := SMA(movingAverageCloses[:10+i], 10)
+		if !ok || !near(got, w, 0.01) {
+			t.Errorf("SMA(10) at close %d = %.4f, %v; want %.2f", 10+i, got, ok, w)
+		}
+	}
+}
+
+func TestEMA(t *testing.T) {
+	want := []float64{
+		22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28,
+		23.34, 23.43, 23.51, 23.54, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08, 22.92,
+	}
+	for i, w := range want {
+		got, ok := EMA(movingAverageCloses[:10+i], 10)
+		if !ok || !near(got, w, 0.01) {
+			t.Errorf("EMA(10) at close %d = %.4f, %v; want %.2f", 10+i, got, ok, w)
+		}
+	}
+}
+
+// On a steady ramp both averages lag the latest value by (n-1)/2 exactly
+func TestMovingAveragesOfRamp(t *testing.T) {
+	ramp := make([]float64, 60)
+	for i := range ramp {
+		ramp[i] = float64(i)
+	}
+
+	for _, n := range []int{1, 5, 12, 26} {
+		want := 59 - float64(n-1)/2
+		if got, ok := SMA(ramp, n); !ok || !near(got, want, 0) {
+			t.Errorf("SMA(%d) = %v, %v; want %v", n, got, ok, want)
+		}
+		if got, ok := EMA(ramp, n); !ok || !near(got, want, 0) {
+			t.Errorf("EMA(%d) = %v, %v; want %v", n, got, ok, want)
+		}
+	}
+}
+
+func TestMovingAveragesNeedEnoughValues(t *testing.T) {
+	values := movingAverageCloses[:9]
+	if _, ok := SMA(values, 10); ok {
+		t.Error("SMA(10) of 9 values reported ok")
+	}
+	if _, ok := EMA(values, 10); ok {
+		t.Error("EMA(10) of 9 values reported ok")
+	}
+	if _, ok := SMA(values, 0); ok {
+		t.Error("SMA(0) reported ok")
+	}
+	if _, ok := EMA(nil, 1); ok {
+		t.Error("EMA(1) of no values reported ok")
+	}
+	if got, ok := SMA(values[:1], 1); !ok || got != values[0] {
+		t.Errorf("SMA(1) = %v, %v; want the value itself", got, ok)
+	}
+}
+
+func TestResample(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Time: day.Add(14 * time.Hour), Price: 10},
+		{Time: day.Add(15 * time.Hour), Price: 12},
+		{Time: day.Add(16 * time.Hour), Price: 9},
+		{Time: day.Add(20 * time.Hour), Price: 11},
+		// Nothing on the 5th, as if the market were closed
+		{Time: day.Add(48*time.Hour + 15*time.Hour), Price: 13},
+	}
+
+	got := Resample(points, 24*time.Hour)
+	want := []Bar{
+		{Start: day, Open: 10, High: 12, Low: 9, Close: 11},
+		{Start: day.Add(48 * time.Hour), Open: 13, High: 13, Low: 13, Close: 13},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d bars, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("bar %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestResampleUsesPointRanges(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Time: day.Add(14 * time.Hour), Price: 10, High: 14, Low: 8},
+		{Time: day.Add(15 * time.Hour), Price: 12},
+		// A range that doesn't include the price only widens the bar
+		{Time: day.Add(16 * time.Hour), Price: 9, High: 11, Low: 9.5},
+	}
+
+	got := Resample(points, 24*time.Hour)
+	want := Bar{Start: day, Open: 10, High: 14, Low: 8, Close: 9}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
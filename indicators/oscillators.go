@@ -0,0 +1,115 @@
+package indicators
+
+import "math"
+
+// RSI returns the relative strength index over n periods using Wilder's
+// smoothing: the first average gain and loss are simple averages of the
+// first n changes, and later changes are folded in with weight 1/n. It
+// reports false if there are fewer than n+1 values.
+func RSI(values []float64, n int) (float64, bool) {
+	if n < 1 || len(values) < n+1 {
+		return 0, false
+	}
+
+	var gain, loss float64
+	for i := 1; i <= n; i++ {
+		change := values[i] - values[i-1]
+		gain += max(change, 0)
+		loss += max(-change, 0)
+	}
+	gain /= float64(n)
+	loss /= float64(n)
+
+	for i := n + 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		gain = (gain*float64(n-1) + max(change, 0)) / float64(n)
+		loss = (loss*float64(n-1) + max(-change, 0)) / float64(n)
+	}
+
+	if loss == 0 {
+		return 100, true
+	}
+	return 100 - 100/(1+gain/loss), true
+}
+
+// Bands are Bollinger Bands: a moving average with bands a number of
+// standard deviations above and below it
+type Bands struct {
+	Lower, Middle, Upper float64
+}
+
+// Bollinger returns Bollinger Bands over the last n values, k population
+// standard deviations either side of their SMA. It reports false if there
+// are fewer than n values.
+func Bollinger(values []float64, n int, k float64) (Bands, bool) {
+	middle, ok := SMA(values, n)
+	if !ok {
+		return Bands{}, false
+	}
+
+	variance := 0.0
+	for _, v := range values[len(values)-n:] {
+		variance += (v - middle) * (v - middle)
+	}
+	width := k * math.Sqrt(variance/float64(n))
+
+	return Bands{Lower: middle - width, Middle: middle, Upper: middle + width}, true
+}
+
+// MACDValue is the moving average convergence/divergence at one bar
+type MACDValue struct {
+	MACD      float64 // fast EMA minus slow EMA
+	Signal    float64 // EMA of the MACD line
+	Histogram float64 // MACD minus signal
+}
+
+// MACD returns the MACD with the given fast, slow and signal periods, e.g.
+// 12, 26 and 9. It reports false if there are fewer than slow+signal-1
+// values, the fewest for which the signal line is defined.
+func MACD(values []float64, fast, slow, signal int) (MACDValue, bool) {
+	if fast < 1 || fast >= slow || signal < 1 || len(values) < slow+signal-1 {
+		return MACDValue{}, false
+	}
+
+	fastSeries := emaSeries(values, fast)
+	slowSeries := emaSeries(values, slow)
+
+	// Align the fast series with the slow one, which starts later
+	fastSeries = fastSeries[slow-fast:]
+	line := make([]float64, len(slowSeries))
+	for i := range slowSeries {
+		line[i] = fastSeries[i] - slowSeries[i]
+	}
+
+	signalSeries := emaSeries(line, signal)
+	m := MACDValue{MACD: line[len(line)-1], Signal: signalSeries[len(signalSeries)-1]}
+	m.Histogram = m.MACD - m.Signal
+	return m, true
+}
+
+// ATR returns the average true range over n bars using Wilder's smoothing.
+// A bar's true range is the largest of its high-low range and the distances
+// from the previous close to its high and low. It reports false if there are
+// fewer than n+1 bars, since the first bar has no previous close.
+func ATR(bars []Bar, n int) (float64, bool) {
+	if n < 1 || len(bars) < n+1 {
+		return 0, false
+	}
+
+	trueRange := func(i int) float64 {
+		prev := bars[i-1].Close
+		b := bars[i]
+		return max(b.High-b.Low, math.Abs(b.High-prev), math.Abs(b.Low-prev))
+	}
+
+	atr := 0.0
+	for i := 1; i <= n; i++ {
+		atr += trueRange(i)
+	}
+	atr /= float64(n)
+
+	for i := n + 1; i < len(bars); i++ {
+		atr = (atr*float64(n-1) + trueRange(i)) / float64(n)
+	}
+	return atr, true
+}
@@ -0,0 +1,183 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+// rsiCloses are the closes from StockCharts' RSI example
+var rsiCloses = []float64{
+	44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+	45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+	46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+	43.42, 42.66, 43.13,
+}
+
+func TestRSI(t *testing.T) {
+	// The first 14 changes gain 3.34 and lose 1.40 in total, so the first
+	// RSI is 100 - 100/(1 + 3.34/1.40)
+	if got, ok := RSI(rsiCloses[:15], 14); !ok || !near(got, 100-100/(1+3.34/1.40), 1e-9) {
+		t.Errorf("first RSI(14) = %.4f, %v; want 70.46", got, ok)
+	}
+
+	// StockCharts' published values differ from the unrounded calculation
+	// by less than a tenth, settling as the series goes on
+	want := []float64{
+		70.53, 66.32, 66.55, 69.41, 66.36, 57.97, 62.93, 63.26, 56.06, 62.38,
+		54.71, 50.42, 39.99, 41.46, 41.87, 45.46, 37.30, 33.08, 37.77,
+	}
+	for i, w := range want {
+		got, ok := RSI(rsiCloses[:15+i], 14)
+		if !ok || !near(got, w, 0.1) {
+			t.Errorf("RSI(14) at close %d = %.4f, %v; want %.2f", 15+i, got, ok, w)
+		}
+	}
+}
+
+func TestRSIExtremes(t *testing.T) {
+	rising := []float64{1, 2, 3, 4, 5, 6}
+	if got, ok := RSI(rising, 5); !ok || got != 100 {
+		t.Errorf("RSI of steady gains = %v, %v; want 100", got, ok)
+	}
+	falling := []float64{6, 5, 4, 3, 2, 1}
+	if got, ok := RSI(falling, 5); !ok || got != 0 {
+		t.Errorf("RSI of steady losses = %v, %v; want 0", got, ok)
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	// StockCharts' Bollinger Band example, 20 days and 2 deviations
+	closes := []float64{
+		86.16, 89.09, 88.78, 90.32, 89.07, 91.15, 89.44, 89.18, 86.93, 87.68,
+		86.96, 89.43, 89.32, 88.72, 87.45, 87.26, 89.50, 87.90, 89.13, 90.70,
+		92.90, 92.98,
+	}
+	want := []Bands{
+		{Lower: 86.12, Middle: 88.71, Upper: 91.29},
+		{Lower: 86.14, Middle: 89.05, Upper: 91.95},
+		{Lower: 85.87, Middle: 89.24, Upper: 92.61},
+	}
+	for i, w := range want {
+		got, ok := Bollinger(closes[:20+i], 20, 2)
+		if !ok || !near(got.Lower, w.Lower, 0.01) || !near(got.Middle, w.Middle, 0.01) || !near(got.Upper, w.Upper, 0.01) {
+			t.Errorf("Bollinger(20, 2) at close %d = %+v, %v; want %+v", 20+i, got, ok, w)
+		}
+	}
+}
+
+func TestMACD(t *testing.T) {
+	// On a steady ramp each EMA lags by (n-1)/2, so the MACD line is
+	// (26-12)/2 throughout and the signal line matches it
+	ramp := make([]float64, 40)
+	for i := range ramp {
+		ramp[i] = float64(i)
+	}
+	if got, ok := MACD(ramp, 12, 26, 9); !ok || !near(got.MACD, 7, 1e-9) || !near(got.Signal, 7, 1e-9) || !near(got.Histogram, 0, 1e-9) {
+		t.Errorf("MACD(12, 26, 9) of a ramp = %+v, %v; want 7, 7, 0", got, ok)
+	}
+
+	// Otherwise it matches the difference of the EMAs at each close, with
+	// the signal line the 9-period EMA of that difference
+	values := make([]float64, 60)
+	for i := range values {
+		values[i] = 100 + 10*math.Sin(float64(i)/5) + float64(i)/10
+	}
+	var line []float64
+	for i := 26; i <= len(values); i++ {
+		fast, _ := EMA(values[:i], 12)
+		slow, _ := EMA(values[:i], 26)
+		line = append(line, fast-slow)
+	}
+	signal, _ := EMA(line, 9)
+
+	got, ok := MACD(values, 12, 26, 9)
+	want := MACDValue{MACD: line[len(line)-1], Signal: signal, Histogram: line[len(line)-1] - signal}
+	if !ok || !near(got.MACD, want.MACD, 1e-9) || !near(got.Signal, want.Signal, 1e-9) || !near(got.Histogram, want.Histogram, 1e-9) {
+		t.Errorf("MACD(12, 26, 9) = %+v, %v; want %+v", got, ok, want)
+	}
+}
+
+func TestATR(t *testing.T) {
+	// True ranges of 2, 2.5 and 3, the last from a gap up over the previous close
+	bars := []Bar{
+		{High: 10, Low: 8, Close: 9},
+		{High: 11, Low: 9, Close: 10},
+		{High: 12, Low: 9.5, Close: 11},
+		{High: 14, Low: 13, Close: 13.5},
+	}
+	if got, ok := ATR(bars[:3], 2); !ok || !near(got, 2.25, 1e-9) {
+		t.Errorf("ATR(2) of 3 bars = %v, %v; want 2.25", got, ok)
+	}
+	if got, ok := ATR(bars, 2); !ok || !near(got, 2.625, 1e-9) {
+		t.Errorf("ATR(2) of 4 bars = %v, %v; want 2.625", got, ok)
+	}
+}
+
+func TestATRStockCharts(t *testing.T) {
+	// StockCharts' ATR example. Its table seeds the average with the first
+	// bar's high-low range, which has no previous close, so its values run a
+	// hundredth or two higher until the seed smooths away.
+	highs := []float64{
+		48.70, 48.72, 48.90, 48.87, 48.82, 49.05, 49.20, 49.35, 49.92, 50.19,
+		50.12, 49.66, 49.88, 50.19, 50.36, 50.57, 50.65, 50.43, 49.63, 50.33,
+		50.29, 50.17, 49.32, 48.50, 48.32, 46.80, 47.80, 48.39, 48.66, 48.79,
+	}
+	lows := []float64{
+		47.79, 48.14, 48.39, 48.37, 48.24, 48.64, 48.94, 48.86, 49.50, 49.87,
+		49.20, 48.90, 49.43, 49.73, 49.26, 50.09, 50.30, 49.21, 48.98, 49.61,
+		49.20, 49.43, 48.08, 47.64, 41.55, 44.28, 47.31, 47.20, 47.90, 47.73,
+	}
+	closes := []float64{
+		48.16, 48.61, 48.75, 48.63, 48.74, 49.03, 49.07, 49.32, 49.91, 50.13,
+		49.53, 49.50, 49.75, 50.03, 50.31, 50.52, 50.41, 49.34, 49.37, 50.23,
+		49.24, 49.93, 48.43, 48.18, 46.57, 45.41, 47.77, 47.72, 48.62, 47.85,
+	}
+	bars := make([]Bar, len(closes))
+	for i := range bars {
+		bars[i] = Bar{High: highs[i], Low: lows[i], Close: closes[i]}
+	}
+
+	// The last six days, after the gap down on day 25
+	want := []float64{1.21, 1.30, 1.38, 1.37, 1.34, 1.32}
+	for i, w := range want {
+		n := len(bars) - len(want) + 1 + i
+		got, ok := ATR(bars[:n], 14)
+		if !ok || !near(got, w, 0.02) {
+			t.Errorf("ATR(14) at bar %d = %.4f, %v; want %.2f", n, got, ok, w)
+		}
+	}
+}
+
+func TestOscillatorsNeedEnoughValues(t *testing.T) {
+	if _, ok := RSI(rsiCloses[:14], 14); ok {
+		t.Error("RSI(14) of 14 closes reported ok, want 15 needed")
+	}
+	if _, ok := RSI(rsiCloses[:15], 14); !ok {
+		t.Error("RSI(14) of 15 closes not ok")
+	}
+	if _, ok := Bollinger(rsiCloses[:19], 20, 2); ok {
+		t.Error("Bollinger(20, 2) of 19 closes reported ok")
+	}
+
+	values := make([]float64, 34)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	if _, ok := MACD(values[:33], 12, 26, 9); ok {
+		t.Error("MACD(12, 26, 9) of 33 values reported ok, want 34 needed")
+	}
+	if _, ok := MACD(values, 12, 26, 9); !ok {
+		t.Error("MACD(12, 26, 9) of 34 values not ok")
+	}
+	if _, ok := MACD(values, 26, 12, 9); ok {
+		t.Error("MACD with fast slower than slow reported ok")
+	}
+
+	bars := make([]Bar, 14)
+	if _, ok := ATR(bars, 14); ok {
+		t.Error("ATR(14) of 14 bars reported ok, want 15 needed")
+	}
+	if _, ok := ATR(append(bars, Bar{}), 14); !ok {
+		t.Error("ATR(14) of 15 bars not ok")
+	}
+}
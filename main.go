@@ -9,16 +9,30 @@ import (
 
 	"github.com/vcavallo/asset-alerts/alerts"
 	"github.com/vcavallo/asset-alerts/config"
-	"github.com/vcavallo/asset-alerts/ntfy"
+	"github.com/vcavallo/asset-alerts/notify"
+	"github.com/vcavallo/asset-alerts/outbox"
 	"github.com/vcavallo/asset-alerts/state"
 	"github.com/vcavallo/asset-alerts/yahoo"
 )
 
+// runner performs price checks with a loaded config and state
+type runner struct {
+	cfg       *config.Config
+	st        *state.State
+	stateFile string
+	notifiers []notify.Notifier
+	outbox    *outbox.Outbox
+	yahoo     *yahoo.Client
+	verbose   bool
+	dryRun    bool
+}
+
 func main() {
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
 	statePath := flag.String("state", "", "Path to state file (default: same directory as config)")
 	verbose := flag.Bool("v", false, "Verbose output")
 	dryRun := flag.Bool("dry-run", false, "Check prices but don't send notifications")
+	daemon := flag.Bool("daemon", false, "Keep running, checking prices every daemon.interval")
 	flag.Parse()
 
 	// Load configuration
@@ -43,74 +57,124 @@ func main() {
 		log.Fatalf("Failed to load state: %v", err)
 	}
 
+	st.MigrateKeys(alerts.LegacyKeys(cfg.Alerts))
+
 	if *verbose {
 		log.Printf("Loaded state from %s", stateFile)
 	}
 
+	notifiers := notify.New(cfg, st)
+
+	r := &runner{
+		cfg:       cfg,
+		st:        st,
+		stateFile: stateFile,
+		notifiers: notifiers,
+		outbox:    outbox.New(cfg, st, notifiers, *verbose),
+		yahoo:     yahoo.NewClient(),
+		verbose:   *verbose,
+		dryRun:    *dryRun,
+	}
+
+	// "digest [name...]" sends digests immediately, for running from cron
+	if flag.Arg(0) == "digest" {
+		if err := r.sendDigests(true, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if *daemon {
+		if err := r.runDaemon(); err != nil {
+			log.Fatalf("Daemon failed: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	if err := r.check(); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(0)
+}
+
+// check fetches prices, sends notifications for triggered alerts and saves state
+func (r *runner) check() error {
 	// Get unique tickers
-	tickers := cfg.GetUniqueTickers()
-	if *verbose {
+	tickers := r.cfg.GetUniqueTickers()
+	if r.verbose {
 		log.Printf("Fetching prices for %d tickers: %v", len(tickers), tickers)
 	}
 
 	// Fetch quotes
-	yahooClient := yahoo.NewClient()
-	quotes, err := yahooClient.GetQuotes(tickers)
+	quotes, err := r.yahoo.GetQuotes(tickers)
 	if err != nil {
-		log.Fatalf("Failed to fetch quotes: %v", err)
+		return fmt.Errorf("failed to fetch quotes: %w", err)
 	}
 
-	if *verbose {
+	if r.verbose {
 		for ticker, quote := range quotes {
 			log.Printf("%s: $%.2f", ticker, quote.Price)
 		}
 	}
 
+	r.backfill(tickers)
+	r.seedAllTimeHighs(tickers)
+
+	r.st.Lock()
+
 	// Evaluate alerts
-	evaluator := alerts.NewEvaluator(st)
-	triggered := evaluator.Evaluate(cfg.Alerts, quotes)
+	evaluator := alerts.NewEvaluator(r.st, r.verbose)
+	triggered := evaluator.Evaluate(r.cfg.Alerts, quotes)
 
-	if *verbose {
+	if r.verbose {
 		log.Printf("Triggered %d alerts", len(triggered))
 	}
 
-	// Send notifications
-	if len(triggered) > 0 && !*dryRun {
-		sender := ntfy.NewSender(cfg.Ntfy)
-
-		for _, alert := range triggered {
-			if *verbose {
-				log.Printf("Sending alert: %s - %s", alert.Ticker, alert.Message)
-			}
-
-			if err := sender.SendAlert(alert.Ticker, alert.Name, alert.Message); err != nil {
-				log.Printf("Failed to send alert for %s: %v", alert.Ticker, err)
-			} else {
-				fmt.Printf("✓ Alert sent: %s - %s\n", alert.Name, alert.Message)
+	// Queue notifications
+	if r.dryRun {
+		if len(triggered) > 0 {
+			fmt.Println("Dry run - would send the following alerts:")
+			for _, alert := range triggered {
+				fmt.Printf("  • %s: %s\n", alert.Name, alert.Message)
 			}
 		}
-	} else if len(triggered) > 0 && *dryRun {
-		fmt.Println("Dry run - would send the following alerts:")
-		for _, alert := range triggered {
-			fmt.Printf("  • %s: %s\n", alert.Name, alert.Message)
-		}
-	} else if *verbose {
+	} else if err := r.outbox.Enqueue(triggered); err != nil {
+		log.Printf("Failed to queue alerts: %v", err)
+	}
+
+	if len(triggered) == 0 && r.verbose {
 		log.Println("No alerts triggered")
 	}
 
 	// Update prices in state
 	for ticker, quote := range quotes {
-		st.UpdatePrice(ticker, quote.Price)
+		r.st.UpdatePrice(ticker, quote.Price, quote.Volume, r.cfg.History.RetentionPeriod(), r.cfg.HistoryResolution(ticker))
+		r.st.UpdateExtremes(ticker, quote.Price, quote.High52w, quote.Low52w)
+	}
+	r.st.Unlock()
+
+	// Deliver everything due, including retries of alerts that failed on
+	// earlier runs, without holding the lock while notifiers send
+	if !r.dryRun {
+		r.outbox.Flush()
+	}
+
+	r.st.Lock()
+	defer r.st.Unlock()
+
+	if r.verbose && r.outbox.Len() > 0 {
+		log.Printf("%d alerts awaiting retry", r.outbox.Len())
 	}
 
 	// Save state
-	if err := st.Save(); err != nil {
-		log.Fatalf("Failed to save state: %v", err)
+	if err := r.st.Save(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
 	}
 
-	if *verbose {
-		log.Printf("State saved to %s", stateFile)
+	if r.verbose {
+		log.Printf("State saved to %s", r.stateFile)
 	}
 
-	os.Exit(0)
+	return nil
 }
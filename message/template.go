@@ -0,0 +1,86 @@
+package message
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Data holds the values available to message and title templates
+type Data struct {
+	Ticker         string
+	Name           string // alert name, falling back to the ticker
+	Price          float64
+	Threshold      float64 // the condition's value: a price, percentage or dollar amount
+	ReferencePrice float64 // last price for thresholds, historical price for changes (0 if unknown)
+	PercentChange  float64 // signed percent change against ReferencePrice
+	AbsoluteChange float64 // signed price change against ReferencePrice
+	Period         string
+	Direction      string // "up" or "down"
+	Currency       string
+	Timestamp      time.Time
+}
+
+// sample is used to test-execute templates at load time so that references
+// to unknown fields fail before any alert fires
+var sample = Data{
+	Ticker:         "BTC-USD",
+	Name:           "Bitcoin",
+	Price:          100000,
+	Threshold:      95000,
+	ReferencePrice: 94000,
+	PercentChange:  6.38,
+	AbsoluteChange: 6000,
+	Period:         "24h",
+	Direction:      "up",
+	Currency:       "USD",
+	Timestamp:      time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+}
+
+var funcs = template.FuncMap{
+	// money formats a price with two decimals, e.g. {{money .Price}} -> "$1234.50"
+	"money": func(v float64) string {
+		if v < 0 {
+			return fmt.Sprintf("-$%.2f", -v)
+		}
+		return fmt.Sprintf("$%.2f", v)
+	},
+	// pct formats a signed percentage, e.g. {{pct .PercentChange}} -> "+2.5%"
+	"pct": func(v float64) string {
+		return fmt.Sprintf("%+.1f%%", v)
+	},
+	"abs":   math.Abs,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// IsTemplate reports whether text contains template actions. Plain strings
+// keep their legacy behavior of having the current price appended.
+func IsTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// Validate parses text and executes it against sample data
+func Validate(text string) error {
+	if _, err := Render(text, sample); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Render executes the template text with data
+func Render(text string, data Data) (string, error) {
+	tmpl, err := template.New("message").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("executing template: %w", err)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// Discord sends notifications to a Discord webhook
+type Discord struct {
+	cfg        config.DiscordConfig
+	httpClient *http.Client
+}
+
+// discordMessage represents the JSON payload for a Discord webhook
+type discordMessage struct {
+	Username  string         `json:"username,omitempty"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Embeds    []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordMaxEmbeds is the most embeds Discord accepts in one message
+const discordMaxEmbeds = 10
+
+// NewDiscord creates a new Discord notifier
+func NewDiscord(cfg config.DiscordConfig) *Discord {
+	return &Discord{
+		cfg:        cfg,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// Name identifies the notifier in logs
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+// SendMessage posts a plain embed
+func (d *Discord) SendMessage(title, message string) error {
+	msg := discordMessage{
+		Username:  d.cfg.Username,
+		AvatarURL: d.cfg.AvatarURL,
+		Embeds: []discordEmbed{{
+			Title:       title,
+			Description: message,
+			Color:       colorNeutral,
+			Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		}},
+	}
+
+	if err := postJSON(d.httpClient, d.cfg.WebhookURL, msg); err != nil {
+		return fmt.Errorf("sending discord message: %w", err)
+	}
+
+	return nil
+}
+
+// SendAlert posts an alert as a color-coded embed
+func (d *Discord) SendAlert(alert alerts.TriggeredAlert) error {
+	return d.post([]discordEmbed{alertEmbed(alert)})
+}
+
+// SendAlerts posts several alerts as embeds in as few messages as Discord
+// allows. If only some of the messages fail, it returns a PartialError
+// naming the alerts in them, so that the others aren't sent again.
+func (d *Discord) SendAlerts(triggered []alerts.TriggeredAlert) error {
+	embeds := make([]discordEmbed, 0, len(triggered))
+	for _, alert := range triggered {
+		embeds = append(embeds, alertEmbed(alert))
+	}
+
+	var failed []int
+	var lastErr error
+	for start := 0; start < len(embeds); start += discordMaxEmbeds {
+		end := min(start+discordMaxEmbeds, len(embeds))
+		if err := d.post(embeds[start:end]); err != nil {
+			lastErr = err
+			for i := start; i < end; i++ {
+				failed = append(failed, i)
+			}
+		}
+	}
+
+	return partial(failed, len(triggered), lastErr)
+}
+
+// post sends embeds in a single webhook message
+func (d *Discord) post(embeds []discordEmbed) error {
+	msg := discordMessage{
+		Username:  d.cfg.Username,
+		AvatarURL: d.cfg.AvatarURL,
+		Embeds:    embeds,
+	}
+
+	if err := postJSON(d.httpClient, d.cfg.WebhookURL, msg); err != nil {
+		return fmt.Errorf("sending discord message: %w", err)
+	}
+
+	return nil
+}
+
+// alertEmbed renders an alert as a color-coded embed
+func alertEmbed(alert alerts.TriggeredAlert) discordEmbed {
+	chartURL := yahoo.QuoteURL(alert.Ticker)
+
+	embed := discordEmbed{
+		Title:       alertTitle(alert),
+		Description: alert.Message,
+		URL:         chartURL,
+		Color:       directionColor(alert.Direction),
+		Fields: []discordField{
+			{Name: "Ticker", Value: alert.Ticker, Inline: true},
+			{Name: "Price", Value: fmt.Sprintf("$%.2f", alert.Price), Inline: true},
+			{Name: "Condition", Value: alert.Condition.Describe(), Inline: true},
+			{Name: "Change", Value: alert.ChangeText(), Inline: true},
+			{Name: "Chart", Value: fmt.Sprintf("[Yahoo Finance](%s)", chartURL), Inline: true},
+		},
+	}
+	if !alert.Timestamp.IsZero() {
+		embed.Timestamp = alert.Timestamp.UTC().Format(time.RFC3339)
+	}
+
+	return embed
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+func TestDiscordSendAlert(t *testing.T) {
+	tests := []struct {
+		direction string
+		color     int
+	}{
+		{"up", 0x2EB67D},
+		{"down", 0xE01E5A},
+		{"", 0x808080},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			srv := newWebhookServer(t)
+			d := NewDiscord(config.DiscordConfig{WebhookURL: srv.URL, Username: "alerts"})
+
+			alert := testAlert(tt.direction)
+			if err := d.SendAlert(alert); err != nil {
+				t.Fatalf("SendAlert: %v", err)
+			}
+
+			var msg discordMessage
+			srv.decode(t, 0, &msg)
+
+			if msg.Username != "alerts" {
+				t.Errorf("username = %q, want alerts", msg.Username)
+			}
+			if len(msg.Embeds) != 1 {
+				t.Fatalf("got %d embeds, want 1", len(msg.Embeds))
+			}
+			embed := msg.Embeds[0]
+			if embed.Color != tt.color {
+				t.Errorf("color = %06X, want %06X", embed.Color, tt.color)
+			}
+			if embed.Title != alertTitle(alert) || embed.Description != alert.Message {
+				t.Errorf("title/description = %q/%q", embed.Title, embed.Description)
+			}
+			if embed.URL != yahoo.QuoteURL("BTC-USD") {
+				t.Errorf("url = %q, want the chart", embed.URL)
+			}
+			if embed.Timestamp != "2025-03-01T12:00:00Z" {
+				t.Errorf("timestamp = %q", embed.Timestamp)
+			}
+
+			want := map[string]string{
+				"Ticker":    "BTC-USD",
+				"Price":     "$102500.00",
+				"Condition": "above $100000.00",
+				"Change":    "+2.50% (+$2500.00)",
+				"Chart":     fmt.Sprintf("[Yahoo Finance](%s)", yahoo.QuoteURL("BTC-USD")),
+			}
+			if len(embed.Fields) != len(want) {
+				t.Fatalf("got %d fields, want %d", len(embed.Fields), len(want))
+			}
+			for _, f := range embed.Fields {
+				if f.Value != want[f.Name] || !f.Inline {
+					t.Errorf("field %s = %q (inline %v), want %q", f.Name, f.Value, f.Inline, want[f.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestDiscordSendAlertsSplitsEmbeds(t *testing.T) {
+	srv := newWebhookServer(t)
+	d := NewDiscord(config.DiscordConfig{WebhookURL: srv.URL})
+
+	triggered := make([]alerts.TriggeredAlert, 23)
+	for i := range triggered {
+		triggered[i] = testAlert("up")
+	}
+	if err := d.SendAlerts(triggered); err != nil {
+		t.Fatalf("SendAlerts: %v", err)
+	}
+
+	if n := srv.requests(); n != 3 {
+		t.Fatalf("got %d requests, want 3", n)
+	}
+	for i, want := range []int{10, 10, 3} {
+		var msg discordMessage
+		srv.decode(t, i, &msg)
+		if len(msg.Embeds) != want {
+			t.Errorf("message %d has %d embeds, want %d", i, len(msg.Embeds), want)
+		}
+	}
+}
+
+func TestDiscordErrors(t *testing.T) {
+	// Errors, including rate limiting, are returned without retrying so the
+	// outbox can retry the alert on a later run
+	for _, status := range []int{400, 404, 429, 500} {
+		srv := newWebhookServer(t, status)
+		srv.reply = `{"message": "You are being rate limited.", "retry_after": 1.5}`
+		d := NewDiscord(config.DiscordConfig{WebhookURL: srv.URL})
+
+		err := d.SendAlert(testAlert("up"))
+		if err == nil {
+			t.Errorf("status %d: got no error", status)
+			continue
+		}
+		if !strings.Contains(err.Error(), fmt.Sprintf("status %d", status)) {
+			t.Errorf("status %d: error %q doesn't include the status", status, err)
+		}
+		if n := srv.requests(); n != 1 {
+			t.Errorf("status %d: got %d requests, want 1", status, n)
+		}
+	}
+
+	// A failed message doesn't stop the others, and only its alerts are
+	// reported as undelivered so the rest aren't sent again
+	srv := newWebhookServer(t, 200, 500)
+	d := NewDiscord(config.DiscordConfig{WebhookURL: srv.URL})
+	err := d.SendAlerts(make([]alerts.TriggeredAlert, 25))
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("SendAlerts: got %v, want a PartialError", err)
+	}
+	if len(partial.Failed) != 10 || partial.Failed[0] != 10 || partial.Failed[9] != 19 {
+		t.Errorf("failed = %v, want alerts 10 to 19", partial.Failed)
+	}
+	if n := srv.requests(); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+
+	// When every message fails, the error is the plain one
+	srv = newWebhookServer(t, 500, 500)
+	d = NewDiscord(config.DiscordConfig{WebhookURL: srv.URL})
+	err = d.SendAlerts(make([]alerts.TriggeredAlert, 15))
+	if err == nil || errors.As(err, &partial) {
+		t.Errorf("SendAlerts: got %v, want a plain error", err)
+	}
+}
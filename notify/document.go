@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+)
+
+// documentVersion is bumped whenever alertDocument changes incompatibly
+const documentVersion = 1
+
+// alertDocument is the versioned JSON representation of a triggered alert
+// handed to external automation
+type alertDocument struct {
+	Version        int               `json:"version"`
+	Type           string            `json:"type"` // always "alert"
+	Ticker         string            `json:"ticker"`
+	Name           string            `json:"name,omitempty"`
+	Condition      documentCondition `json:"condition"`
+	Price          float64           `json:"price"`
+	ReferencePrice *float64          `json:"reference_price"` // null if unknown
+	Direction      string            `json:"direction"`
+	Message        string            `json:"message"`
+	Timestamp      time.Time         `json:"timestamp"`
+}
+
+type documentCondition struct {
+	Type   string  `json:"type"`
+	Value  float64 `json:"value"`
+	Period string  `json:"period,omitempty"`
+}
+
+// noticeDocument is the versioned JSON representation of a notice that
+// isn't tied to a single alert, such as an expired delivery
+type noticeDocument struct {
+	Version   int       `json:"version"`
+	Type      string    `json:"type"` // always "notice"
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// groupDocument is the versioned JSON representation of several alerts
+// delivered together when grouping is enabled
+type groupDocument struct {
+	Version   int             `json:"version"`
+	Type      string          `json:"type"` // always "group"
+	Title     string          `json:"title"`
+	Alerts    []alertDocument `json:"alerts"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// newGroupDocument creates a group document stamped with the current time
+func newGroupDocument(triggered []alerts.TriggeredAlert) groupDocument {
+	docs := make([]alertDocument, 0, len(triggered))
+	for _, alert := range triggered {
+		docs = append(docs, newAlertDocument(alert))
+	}
+
+	return groupDocument{
+		Version:   documentVersion,
+		Type:      "group",
+		Title:     alerts.Summary(triggered),
+		Alerts:    docs,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// newNoticeDocument creates a notice document stamped with the current time
+func newNoticeDocument(title, message string) noticeDocument {
+	return noticeDocument{
+		Version:   documentVersion,
+		Type:      "notice",
+		Title:     title,
+		Message:   message,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// newAlertDocument converts a triggered alert to its JSON document form
+func newAlertDocument(alert alerts.TriggeredAlert) alertDocument {
+	doc := alertDocument{
+		Version: documentVersion,
+		Type:    "alert",
+		Ticker:  alert.Ticker,
+		Name:    alert.Name,
+		Condition: documentCondition{
+			Type:   alert.Condition.Type,
+			Value:  alert.Condition.Value,
+			Period: alert.Condition.Period,
+		},
+		Price:     alert.Price,
+		Direction: alert.Direction,
+		Message:   alert.Message,
+		Timestamp: alert.Timestamp.UTC(),
+	}
+
+	if alert.ReferencePrice != 0 {
+		ref := alert.ReferencePrice
+		doc.ReferencePrice = &ref
+	}
+
+	return doc
+}
@@ -0,0 +1,267 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// Email sends notifications over SMTP
+type Email struct {
+	cfg config.EmailConfig
+}
+
+// emailRow is one alert as rendered in the HTML body
+type emailRow struct {
+	Ticker    string
+	Message   string
+	Price     string
+	Condition string
+	Change    string
+	Color     string
+	ChartURL  string
+}
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<h2>{{.Heading}}</h2>
+<table cellpadding="6" cellspacing="0" style="border-collapse: collapse;">
+<tr style="text-align: left; border-bottom: 1px solid #ccc;">
+<th>Ticker</th><th>Alert</th><th>Price</th><th>Condition</th><th>Change</th><th></th>
+</tr>
+{{range .Rows}}<tr style="border-left: 4px solid {{.Color}};">
+<td><strong>{{.Ticker}}</strong></td>
+<td>{{.Message}}</td>
+<td>{{.Price}}</td>
+<td>{{.Condition}}</td>
+<td style="color: {{.Color}};">{{.Change}}</td>
+<td><a href="{{.ChartURL}}">Chart</a></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// NewEmail creates a new SMTP email notifier
+func NewEmail(cfg config.EmailConfig) *Email {
+	return &Email{cfg: cfg}
+}
+
+// Name identifies the notifier in logs
+func (e *Email) Name() string {
+	return "email"
+}
+
+// Batched reports whether alerts should be combined into one digest email
+func (e *Email) Batched() bool {
+	return e.cfg.Digest
+}
+
+// SendMessage emails a plain text notice
+func (e *Email) SendMessage(title, message string) error {
+	var msg bytes.Buffer
+	e.writeHeaders(&msg, title)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(&msg, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(message)
+	msg.WriteString("\r\n")
+
+	if err := e.deliver(msg.Bytes()); err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+
+	return nil
+}
+
+// SendAlert emails a single alert
+func (e *Email) SendAlert(alert alerts.TriggeredAlert) error {
+	return e.send(alertTitle(alert), []alerts.TriggeredAlert{alert})
+}
+
+// SendAlerts emails every alert in one HTML summary
+func (e *Email) SendAlerts(triggered []alerts.TriggeredAlert) error {
+	if len(triggered) == 0 {
+		return nil
+	}
+	if len(triggered) == 1 {
+		return e.SendAlert(triggered[0])
+	}
+
+	var tickers []string
+	for _, alert := range triggered {
+		tickers = append(tickers, alert.Ticker)
+	}
+	subject := fmt.Sprintf("%d price alerts: %s", len(triggered), strings.Join(tickers, ", "))
+
+	return e.send(subject, triggered)
+}
+
+// send renders the alerts and delivers them with the given subject
+func (e *Email) send(subject string, triggered []alerts.TriggeredAlert) error {
+	msg, err := e.buildMessage(subject, triggered)
+	if err != nil {
+		return fmt.Errorf("building email: %w", err)
+	}
+
+	if err := e.deliver(msg); err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+
+	return nil
+}
+
+// buildMessage renders a multipart/alternative message with text and HTML parts
+func (e *Email) buildMessage(subject string, triggered []alerts.TriggeredAlert) ([]byte, error) {
+	var text strings.Builder
+	rows := make([]emailRow, 0, len(triggered))
+	for _, alert := range triggered {
+		fmt.Fprintf(&text, "%s\n%s\nPrice: $%.2f\nCondition: %s\nChange: %s\nChart: %s\n\n",
+			alertTitle(alert), alert.Message, alert.Price, alert.Condition.Describe(),
+			alert.ChangeText(), yahoo.QuoteURL(alert.Ticker))
+
+		rows = append(rows, emailRow{
+			Ticker:    alert.Ticker,
+			Message:   alert.Message,
+			Price:     fmt.Sprintf("$%.2f", alert.Price),
+			Condition: alert.Condition.Describe(),
+			Change:    alert.ChangeText(),
+			Color:     fmt.Sprintf("#%06X", directionColor(alert.Direction)),
+			ChartURL:  yahoo.QuoteURL(alert.Ticker),
+		})
+	}
+
+	var html bytes.Buffer
+	data := struct {
+		Heading string
+		Rows    []emailRow
+	}{subject, rows}
+	if err := emailTemplate.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("rendering html: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", text.String()},
+		{"text/html; charset=UTF-8", html.String()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	e.writeHeaders(&msg, subject)
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// writeHeaders writes the envelope headers shared by every message
+func (e *Email) writeHeaders(msg *bytes.Buffer, subject string) {
+	fmt.Fprintf(msg, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+}
+
+// deliver opens an SMTP session according to the TLS mode and sends msg
+func (e *Email) deliver(msg []byte) error {
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: e.cfg.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	if e.cfg.TLS == "implicit" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("starting smtp session: %w", err)
+	}
+	defer c.Close()
+
+	if e.cfg.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starting tls: %w", err)
+		}
+	}
+
+	if e.cfg.Username != "" {
+		auth := smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(e.cfg.From)
+	if err != nil {
+		return fmt.Errorf("parsing sender address: %w", err)
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("setting sender: %w", err)
+	}
+	for _, to := range e.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("adding recipient %s: %w", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("starting data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("finishing message: %w", err)
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,303 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// smtpSink is an in-process SMTP server that accepts every message
+type smtpSink struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	auth     string
+	from     string
+	rcpts    []string
+	messages []string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	s := &smtpSink{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-sink")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			fields := strings.Fields(line)
+			decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			s.mu.Lock()
+			s.auth = string(decoded)
+			s.mu.Unlock()
+			reply("235 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = line
+			s.mu.Unlock()
+			reply("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, line)
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// count returns the number of messages received
+func (s *smtpSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+// message parses the i-th received message
+func (s *smtpSink) message(t *testing.T, i int) *mail.Message {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i >= len(s.messages) {
+		t.Fatalf("got %d messages, want at least %d", len(s.messages), i+1)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(s.messages[i]))
+	if err != nil {
+		t.Fatalf("parsing message: %v", err)
+	}
+	return msg
+}
+
+// parts returns the bodies of a multipart message keyed by media type
+func parts(t *testing.T, msg *mail.Message) map[string]string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+
+	found := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		body, _ := io.ReadAll(p)
+		partType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		found[partType] = string(body)
+	}
+	return found
+}
+
+func testEmail(sink *smtpSink) *Email {
+	return NewEmail(config.EmailConfig{
+		Host:     "127.0.0.1",
+		Port:     sink.port(),
+		Username: "alerts",
+		Password: "secret",
+		From:     "Price Alerts <alerts@example.com>",
+		To:       []string{"alice@example.com", "bob@example.com"},
+		TLS:      "none",
+	})
+}
+
+func TestEmailSendAlert(t *testing.T) {
+	sink := newSMTPSink(t)
+	e := testEmail(sink)
+
+	alert := testAlert("up")
+	if err := e.SendAlert(alert); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+
+	sink.mu.Lock()
+	if sink.auth != "\x00alerts\x00secret" {
+		t.Errorf("auth = %q, want PLAIN credentials", sink.auth)
+	}
+	if sink.from != "MAIL FROM:<alerts@example.com>" {
+		t.Errorf("sender = %q", sink.from)
+	}
+	want := []string{"RCPT TO:<alice@example.com>", "RCPT TO:<bob@example.com>"}
+	if strings.Join(sink.rcpts, "|") != strings.Join(want, "|") {
+		t.Errorf("recipients = %q, want %q", sink.rcpts, want)
+	}
+	sink.mu.Unlock()
+
+	msg := sink.message(t, 0)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != alertTitle(alert) {
+		t.Errorf("subject = %q, want %q", subject, alertTitle(alert))
+	}
+	if got := msg.Header.Get("To"); got != "alice@example.com, bob@example.com" {
+		t.Errorf("To = %q", got)
+	}
+
+	bodies := parts(t, msg)
+	text := bodies["text/plain"]
+	for _, want := range []string{
+		alert.Message,
+		"Price: $102500.00",
+		"Condition: above $100000.00",
+		"Change: +2.50% (+$2500.00)",
+		"Chart: " + yahoo.QuoteURL("BTC-USD"),
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text body doesn't contain %q:\n%s", want, text)
+		}
+	}
+
+	html := bodies["text/html"]
+	for _, want := range []string{
+		"<strong>BTC-USD</strong>",
+		"$102500.00",
+		"border-left: 4px solid #2EB67D",
+		`<a href="` + yahoo.QuoteURL("BTC-USD") + `">Chart</a>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("html body doesn't contain %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestEmailSendAlertsDigest(t *testing.T) {
+	sink := newSMTPSink(t)
+	e := testEmail(sink)
+
+	eth := testAlert("down")
+	eth.Ticker = "ETH-USD"
+	eth.Message = "Ethereum fell below $3000.00"
+	if err := e.SendAlerts([]alerts.TriggeredAlert{testAlert("up"), eth}); err != nil {
+		t.Fatalf("SendAlerts: %v", err)
+	}
+
+	if sink.count() != 1 {
+		t.Fatalf("got %d messages, want 1", sink.count())
+	}
+	msg := sink.message(t, 0)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "2 price alerts: BTC-USD, ETH-USD" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	bodies := parts(t, msg)
+	for _, want := range []string{"Bitcoin crossed above", "Ethereum fell below"} {
+		if !strings.Contains(bodies["text/plain"], want) || !strings.Contains(bodies["text/html"], want) {
+			t.Errorf("bodies don't both contain %q", want)
+		}
+	}
+	if rows := strings.Count(bodies["text/html"], "border-left: 4px solid"); rows != 2 {
+		t.Errorf("html has %d rows, want 2", rows)
+	}
+	if !strings.Contains(bodies["text/html"], "#E01E5A") {
+		t.Error("html doesn't color the falling alert")
+	}
+}
+
+func TestEmailSendMessage(t *testing.T) {
+	sink := newSMTPSink(t)
+	e := testEmail(sink)
+
+	if err := e.SendMessage("Alert not delivered", "Bitcoin crossed above $100000.00"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	msg := sink.message(t, 0)
+	if ct := msg.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type = %q, want text/plain", ct)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if strings.TrimSpace(string(body)) != "Bitcoin crossed above $100000.00" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestEmailStartTLSUnsupported(t *testing.T) {
+	sink := newSMTPSink(t)
+	e := NewEmail(config.EmailConfig{
+		Host: "127.0.0.1",
+		Port: sink.port(),
+		From: "alerts@example.com",
+		To:   []string{"alice@example.com"},
+		TLS:  "starttls",
+	})
+
+	err := e.SendAlert(testAlert("up"))
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("err = %v, want a STARTTLS error", err)
+	}
+	if sink.count() != 0 {
+		t.Errorf("got %d messages over plain text, want none", sink.count())
+	}
+}
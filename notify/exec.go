@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+)
+
+// Exec runs a local command for each alert (or batch of alerts)
+type Exec struct {
+	cfg     config.ExecConfig
+	timeout time.Duration
+}
+
+// NewExec creates a new exec notifier
+func NewExec(cfg config.ExecConfig) *Exec {
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil {
+		timeout = 30 * time.Second
+	}
+
+	return &Exec{
+		cfg:     cfg,
+		timeout: timeout,
+	}
+}
+
+// Name identifies the notifier in logs
+func (e *Exec) Name() string {
+	return "exec"
+}
+
+// Batched reports whether the command runs once with all alerts from a run
+func (e *Exec) Batched() bool {
+	return e.cfg.Batch
+}
+
+// SendAlert runs the command with the alert document on stdin and as ALERT_* variables
+func (e *Exec) SendAlert(alert alerts.TriggeredAlert) error {
+	doc := newAlertDocument(alert)
+
+	stdin, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshaling alert: %w", err)
+	}
+
+	return e.run(stdin, alertEnv(doc))
+}
+
+// SendMessage runs the command with a notice document on stdin
+func (e *Exec) SendMessage(title, message string) error {
+	stdin, err := json.Marshal(newNoticeDocument(title, message))
+	if err != nil {
+		return fmt.Errorf("marshaling notice: %w", err)
+	}
+
+	env := []string{
+		"ALERT_TYPE=notice",
+		"ALERT_TITLE=" + title,
+		"ALERT_MESSAGE=" + message,
+	}
+
+	return e.run(stdin, env)
+}
+
+// SendAlerts runs the command once with a JSON array of alert documents on stdin
+func (e *Exec) SendAlerts(triggered []alerts.TriggeredAlert) error {
+	if len(triggered) == 0 {
+		return nil
+	}
+
+	docs := make([]alertDocument, 0, len(triggered))
+	var tickers []string
+	for _, alert := range triggered {
+		docs = append(docs, newAlertDocument(alert))
+		tickers = append(tickers, alert.Ticker)
+	}
+
+	stdin, err := json.Marshal(docs)
+	if err != nil {
+		return fmt.Errorf("marshaling alerts: %w", err)
+	}
+
+	env := []string{
+		"ALERT_COUNT=" + strconv.Itoa(len(triggered)),
+		"ALERT_TICKERS=" + strings.Join(tickers, ","),
+	}
+
+	return e.run(stdin, env)
+}
+
+// run executes the command, logging its output and failing on timeout or non-zero exit
+func (e *Exec) run(stdin []byte, env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, e.cfg.Command[0], e.cfg.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.WaitDelay = time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	logOutput("stdout", stdout.Bytes())
+	logOutput("stderr", stderr.Bytes())
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("command timed out after %s", e.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("running command: %w", err)
+	}
+
+	return nil
+}
+
+// maxOutputLine is the longest line of command output that is logged
+const maxOutputLine = 1 << 20
+
+// logOutput writes each line of a command's output stream to the run log
+func logOutput(stream string, output []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxOutputLine)
+	for scanner.Scan() {
+		log.Printf("exec %s: %s", stream, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("exec %s: output not fully logged: %v", stream, err)
+	}
+}
+
+// alertEnv exposes an alert document as ALERT_* environment variables
+func alertEnv(doc alertDocument) []string {
+	ref := ""
+	if doc.ReferencePrice != nil {
+		ref = strconv.FormatFloat(*doc.ReferencePrice, 'f', -1, 64)
+	}
+
+	return []string{
+		"ALERT_TYPE=alert",
+		"ALERT_TICKER=" + doc.Ticker,
+		"ALERT_NAME=" + doc.Name,
+		"ALERT_CONDITION_TYPE=" + doc.Condition.Type,
+		"ALERT_CONDITION_VALUE=" + strconv.FormatFloat(doc.Condition.Value, 'f', -1, 64),
+		"ALERT_CONDITION_PERIOD=" + doc.Condition.Period,
+		"ALERT_PRICE=" + strconv.FormatFloat(doc.Price, 'f', -1, 64),
+		"ALERT_REFERENCE_PRICE=" + ref,
+		"ALERT_DIRECTION=" + doc.Direction,
+		"ALERT_MESSAGE=" + doc.Message,
+		"ALERT_TIMESTAMP=" + doc.Timestamp.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+)
+
+// captureLog collects what is written to the standard logger during a test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func shell(script string) config.ExecConfig {
+	return config.ExecConfig{Command: []string{"sh", "-c", script}, Timeout: "5s"}
+}
+
+func TestExecSendAlertStdinAndEnv(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	e := NewExec(shell(`cat > "$0.json"; printf '%s|%s|%s' "$ALERT_TICKER" "$ALERT_PRICE" "$ALERT_REFERENCE_PRICE" > "$0.env"`))
+	e.cfg.Command = append(e.cfg.Command, out)
+
+	if err := e.SendAlert(testAlert("up")); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+
+	data, err := os.ReadFile(out + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc alertDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("stdin isn't an alert document: %v\n%s", err, data)
+	}
+	if doc.Version != 1 || doc.Type != "alert" || doc.Ticker != "BTC-USD" || doc.Price != 102500 || doc.Direction != "up" {
+		t.Errorf("document = %+v", doc)
+	}
+
+	env, _ := os.ReadFile(out + ".env")
+	if string(env) != "BTC-USD|102500|100000" {
+		t.Errorf("environment = %q", env)
+	}
+}
+
+func TestExecSendAlertsBatch(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	e := NewExec(shell(`cat > "$0"; test "$ALERT_COUNT" = 3 && test "$ALERT_TICKERS" = BTC-USD,ETH-USD,SOL-USD`))
+	e.cfg.Command = append(e.cfg.Command, out)
+
+	if err := e.SendAlerts(routedAlerts(t)); err != nil {
+		t.Fatalf("SendAlerts: %v", err)
+	}
+	var docs []alertDocument
+	data, _ := os.ReadFile(out)
+	if err := json.Unmarshal(data, &docs); err != nil || len(docs) != 3 {
+		t.Errorf("stdin = %s, want an array of 3 documents", data)
+	}
+}
+
+func TestExecFailures(t *testing.T) {
+	captureLog(t)
+
+	// A non-zero exit is an error, so the outbox retries the alert
+	err := NewExec(shell("echo oops >&2; exit 3")).SendAlert(testAlert("up"))
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("non-zero exit: got %v, want exit status 3", err)
+	}
+
+	cfg := shell("sleep 10")
+	cfg.Timeout = "100ms"
+	start := time.Now()
+	err = NewExec(cfg).SendAlert(testAlert("up"))
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("timeout: got %v, want a timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("timeout took %s", elapsed)
+	}
+}
+
+func TestExecLogsLongOutput(t *testing.T) {
+	logs := captureLog(t)
+
+	// A 100 KB line is longer than bufio.Scanner's default limit
+	if err := NewExec(shell("head -c 100000 /dev/zero | tr '\\0' x; echo; echo done")).SendMessage("t", "m"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if !strings.Contains(logs.String(), strings.Repeat("x", 100000)) || !strings.Contains(logs.String(), "exec stdout: done") {
+		t.Errorf("long line or the line after it wasn't logged")
+	}
+
+	// Lines beyond the limit are reported rather than silently dropped
+	logs.Reset()
+	logOutput("stdout", bytes.Repeat([]byte("y"), maxOutputLine+1))
+	if !strings.Contains(logs.String(), "output not fully logged") {
+		t.Errorf("log = %.200q, want the scan error", logs.String())
+	}
+}
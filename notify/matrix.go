@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// Matrix sends notifications through the Matrix client-server API
+type Matrix struct {
+	cfg        config.MatrixConfig
+	httpClient *http.Client
+}
+
+// matrixMessage represents an m.room.message event with markdown and HTML bodies
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+// matrixError represents an error response from the homeserver
+type matrixError struct {
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// NewMatrix creates a new Matrix notifier
+func NewMatrix(cfg config.MatrixConfig) *Matrix {
+	return &Matrix{
+		cfg:        cfg,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// Name identifies the notifier in logs
+func (m *Matrix) Name() string {
+	return "matrix"
+}
+
+// Destination returns the room an alert is posted to
+func (m *Matrix) Destination(alert alerts.TriggeredAlert) string {
+	if alert.Alert.MatrixRoomID != "" {
+		return alert.Alert.MatrixRoomID
+	}
+	return m.cfg.RoomID
+}
+
+// SendAlert posts an alert as a formatted message to the alert's room
+func (m *Matrix) SendAlert(alert alerts.TriggeredAlert) error {
+	return m.send(m.Destination(alert), matrixText(alert))
+}
+
+// SendMessage posts a plain notice to the default room
+func (m *Matrix) SendMessage(title, message string) error {
+	return m.SendMessageTo(m.cfg.RoomID, title, message)
+}
+
+// SendMessageTo posts a plain notice to a room
+func (m *Matrix) SendMessageTo(roomID, title, message string) error {
+	if roomID == "" {
+		return fmt.Errorf("matrix.room_id is required for notices")
+	}
+	esc := html.EscapeString
+	return m.send(roomID, matrixMessage{
+		MsgType:       "m.notice",
+		Body:          fmt.Sprintf("**%s**\n\n%s", title, message),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: fmt.Sprintf("<p><strong>%s</strong></p><p>%s</p>", esc(title), strings.ReplaceAll(esc(message), "\n", "<br>")),
+	})
+}
+
+// send posts a message event to a room, retrying when rate limited
+func (m *Matrix) send(roomID string, msg matrixMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshaling matrix message: %w", err)
+	}
+
+	// The transaction ID stays fixed across retries so the homeserver deduplicates them
+	txnID := fmt.Sprintf("asset-alerts-%d", time.Now().UnixNano())
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(m.cfg.Homeserver, "/"), url.PathEscape(roomID), txnID)
+
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+m.cfg.AccessToken)
+		return req, nil
+	}
+
+	if err := sendWithRetry(m.httpClient, m.cfg.MaxRetries, newReq, matrixRetryAfter); err != nil {
+		return fmt.Errorf("sending matrix message: %w", err)
+	}
+
+	return nil
+}
+
+// matrixText formats an alert as markdown with an equivalent HTML rendering
+func matrixText(alert alerts.TriggeredAlert) matrixMessage {
+	title := alertTitle(alert)
+	chartURL := yahoo.QuoteURL(alert.Ticker)
+	price := fmt.Sprintf("$%.2f", alert.Price)
+	cond := alert.Condition.Describe()
+	change := alert.ChangeText()
+
+	var md strings.Builder
+	fmt.Fprintf(&md, "**%s**\n\n%s\n\n", title, alert.Message)
+	fmt.Fprintf(&md, "- **Price:** %s\n- **Condition:** %s\n- **Change:** %s\n\n", price, cond, change)
+	fmt.Fprintf(&md, "[View chart](%s)", chartURL)
+
+	esc := html.EscapeString
+	var h strings.Builder
+	fmt.Fprintf(&h, "<p><strong>%s</strong></p><p>%s</p>", esc(title), esc(alert.Message))
+	fmt.Fprintf(&h, "<ul><li><strong>Price:</strong> %s</li><li><strong>Condition:</strong> %s</li><li><strong>Change:</strong> %s</li></ul>",
+		esc(price), esc(cond), esc(change))
+	fmt.Fprintf(&h, `<p><a href="%s">View chart</a></p>`, esc(chartURL))
+
+	return matrixMessage{
+		MsgType:       "m.text",
+		Body:          md.String(),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: h.String(),
+	}
+}
+
+// matrixRetryAfter reads the retry delay from an M_LIMIT_EXCEEDED response
+func matrixRetryAfter(body []byte) time.Duration {
+	var resp matrixError
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0
+	}
+	return time.Duration(resp.RetryAfterMs) * time.Millisecond
+}
@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+)
+
+func TestMatrixSendAlertRoutesByRoom(t *testing.T) {
+	srv := newWebhookServer(t)
+	m := NewMatrix(config.MatrixConfig{Homeserver: srv.URL + "/", AccessToken: "syt_secret", RoomID: "!default:example.com"})
+
+	routed := routedAlerts(t)
+	unrouted := testAlert("up")
+	for _, alert := range append(routed[:2], unrouted) {
+		if err := m.SendAlert(alert); err != nil {
+			t.Fatalf("SendAlert: %v", err)
+		}
+	}
+
+	for i, room := range []string{"!btc:example.com", "!eth:example.com", "!default:example.com"} {
+		prefix := "/_matrix/client/v3/rooms/" + room + "/send/m.room.message/asset-alerts-"
+		if !strings.HasPrefix(srv.paths[i], prefix) {
+			t.Errorf("request %d path = %q, want %s<txn>", i, srv.paths[i], prefix)
+		}
+		if srv.methods[i] != http.MethodPut {
+			t.Errorf("request %d method = %s, want PUT", i, srv.methods[i])
+		}
+		if auth := srv.headers[i].Get("Authorization"); auth != "Bearer syt_secret" {
+			t.Errorf("request %d authorization = %q", i, auth)
+		}
+	}
+	if srv.paths[0] == srv.paths[1] {
+		t.Error("two messages shared a transaction ID")
+	}
+
+	var msg matrixMessage
+	srv.decode(t, 0, &msg)
+	if msg.MsgType != "m.text" || msg.Format != "org.matrix.custom.html" {
+		t.Errorf("msgtype/format = %q/%q", msg.MsgType, msg.Format)
+	}
+	if !strings.Contains(msg.Body, "Bitcoin crossed above") || !strings.Contains(msg.FormattedBody, "<strong>Price:</strong> $102500.00") {
+		t.Errorf("message = %+v", msg)
+	}
+}
+
+func TestMatrixSendGroupRoutesByRoom(t *testing.T) {
+	srv := newWebhookServer(t)
+	m := NewMatrix(config.MatrixConfig{Homeserver: srv.URL, AccessToken: "syt_secret"})
+
+	if err := SendGroup(m, routedAlerts(t)); err != nil {
+		t.Fatalf("SendGroup: %v", err)
+	}
+	if n := srv.requests(); n != 2 {
+		t.Fatalf("got %d messages, want one per room", n)
+	}
+
+	bodies := map[string]string{}
+	for i := 0; i < 2; i++ {
+		var msg matrixMessage
+		srv.decode(t, i, &msg)
+		room := strings.Split(strings.TrimPrefix(srv.paths[i], "/_matrix/client/v3/rooms/"), "/")[0]
+		bodies[room] = msg.Body
+		if msg.MsgType != "m.notice" {
+			t.Errorf("msgtype = %q, want m.notice", msg.MsgType)
+		}
+	}
+	if b := bodies["!btc:example.com"]; !strings.Contains(b, "Bitcoin") || !strings.Contains(b, "Solana") {
+		t.Errorf("!btc got %q, want the BTC and SOL alerts", b)
+	}
+	if b := bodies["!eth:example.com"]; !strings.Contains(b, "Ethereum") || strings.Contains(b, "Bitcoin") {
+		t.Errorf("!eth got %q, want only the ETH alert", b)
+	}
+
+	// Without a default room, plain notices can't be sent, but notices
+	// about an alert go to its room
+	if err := SendNotice(m, routedAlerts(t)[1], "⚠️ Alert not delivered", "lost"); err != nil {
+		t.Errorf("SendNotice: %v", err)
+	}
+	if path := srv.paths[2]; !strings.HasPrefix(path, "/_matrix/client/v3/rooms/!eth:example.com/") {
+		t.Errorf("notice sent to %q, want !eth:example.com", path)
+	}
+	if err := m.SendMessage("Digest", "prices"); err == nil {
+		t.Error("SendMessage without a room: got no error")
+	}
+}
+
+func TestMatrixRateLimit(t *testing.T) {
+	srv := newWebhookServer(t, 429, 429)
+	srv.reply = `{"errcode": "M_LIMIT_EXCEEDED", "error": "Too many requests", "retry_after_ms": 50}`
+	m := NewMatrix(config.MatrixConfig{Homeserver: srv.URL, AccessToken: "syt_secret", RoomID: "!room:example.com", MaxRetries: 3})
+
+	start := time.Now()
+	if err := m.SendAlert(testAlert("up")); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("retried after %s, want two waits of retry_after_ms", elapsed)
+	}
+	if n := srv.requests(); n != 3 {
+		t.Fatalf("got %d requests, want 3", n)
+	}
+	// Retries reuse the transaction ID, so the homeserver deduplicates them
+	if srv.paths[0] != srv.paths[1] || srv.paths[1] != srv.paths[2] {
+		t.Errorf("retries changed the transaction ID: %v", srv.paths)
+	}
+
+	// Giving up after max_retries returns the status
+	srv = newWebhookServer(t, 429, 429)
+	srv.reply = `{"errcode": "M_LIMIT_EXCEEDED", "retry_after_ms": 1}`
+	m = NewMatrix(config.MatrixConfig{Homeserver: srv.URL, AccessToken: "syt_secret", RoomID: "!room:example.com", MaxRetries: 1})
+	if err := m.SendAlert(testAlert("up")); err == nil || !strings.Contains(err.Error(), "status 429") {
+		t.Errorf("SendAlert: got %v, want a 429 error", err)
+	}
+	if n := srv.requests(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+
+	// Other errors aren't retried
+	srv = newWebhookServer(t, 403)
+	srv.reply = `{"errcode": "M_FORBIDDEN"}`
+	m = NewMatrix(config.MatrixConfig{Homeserver: srv.URL, AccessToken: "syt_secret", RoomID: "!room:example.com", MaxRetries: 3})
+	if err := m.SendAlert(testAlert("up")); err == nil || srv.requests() != 1 {
+		t.Errorf("403: got %v after %d requests, want an error after 1", err, srv.requests())
+	}
+}
@@ -0,0 +1,299 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/ntfy"
+	"github.com/vcavallo/asset-alerts/state"
+)
+
+// Notifier delivers triggered alerts to a single destination
+type Notifier interface {
+	// Name identifies the notifier in logs
+	Name() string
+	// SendAlert delivers one triggered alert
+	SendAlert(alert alerts.TriggeredAlert) error
+	// SendMessage delivers a plain notice that isn't tied to a single alert
+	SendMessage(title, message string) error
+}
+
+// GroupNotifier is a Notifier that can deliver several alerts as one notification
+type GroupNotifier interface {
+	Notifier
+	// SendAlerts delivers several alerts at once
+	SendAlerts(alerts []alerts.TriggeredAlert) error
+}
+
+// PartialError is returned when a notifier sends several alerts in more than
+// one message and only some of the messages fail. Failed holds the indexes of
+// the alerts that weren't delivered; the others were.
+type PartialError struct {
+	Failed []int
+	Err    error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%d alerts not delivered: %v", len(e.Failed), e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// partial returns the error for sending total alerts of which failed weren't
+// delivered: nil if all were, err if none were, and a PartialError otherwise
+func partial(failed []int, total int, err error) error {
+	switch len(failed) {
+	case 0:
+		return nil
+	case total:
+		return err
+	}
+	return &PartialError{Failed: failed, Err: err}
+}
+
+// RoutedNotifier is a Notifier that sends each alert to a destination chosen
+// per alert, such as a chat or room
+type RoutedNotifier interface {
+	Notifier
+	// Destination identifies where alert is delivered
+	Destination(alert alerts.TriggeredAlert) string
+	// SendMessageTo delivers a plain notice to a destination
+	SendMessageTo(destination, title, message string) error
+}
+
+// BatchNotifier is a GroupNotifier that can combine all alerts from a run into one message
+type BatchNotifier interface {
+	GroupNotifier
+	// Batched reports whether alerts should always be sent together
+	Batched() bool
+}
+
+// Colors used to code alerts by direction
+const (
+	colorUp      = 0x2EB67D
+	colorDown    = 0xE01E5A
+	colorNeutral = 0x808080
+)
+
+// maxRetryWait caps how long a rate-limited notifier waits before retrying
+const maxRetryWait = time.Minute
+
+// New creates a notifier for every destination enabled in the config.
+// st provides price history for notifiers that render charts.
+func New(cfg *config.Config, st *state.State) []Notifier {
+	var notifiers []Notifier
+
+	if cfg.Ntfy.Enabled() {
+		sender := ntfy.NewSender(cfg.Ntfy).
+			WithCallback(cfg.Daemon.PublicURL, cfg.Daemon.Token).
+			WithState(st)
+		notifiers = append(notifiers, sender)
+	}
+	if cfg.Slack.Enabled() {
+		notifiers = append(notifiers, NewSlack(cfg.Slack))
+	}
+	if cfg.Discord.Enabled() {
+		notifiers = append(notifiers, NewDiscord(cfg.Discord))
+	}
+	if cfg.Email.Enabled() {
+		notifiers = append(notifiers, NewEmail(cfg.Email))
+	}
+	if cfg.Telegram.Enabled() {
+		notifiers = append(notifiers, NewTelegram(cfg.Telegram))
+	}
+	if cfg.Matrix.Enabled() {
+		notifiers = append(notifiers, NewMatrix(cfg.Matrix))
+	}
+	if cfg.Webhook.Enabled() {
+		notifiers = append(notifiers, NewWebhook(cfg.Webhook))
+	}
+	if cfg.Exec.Enabled() {
+		notifiers = append(notifiers, NewExec(cfg.Exec))
+	}
+
+	return notifiers
+}
+
+// SendGroup delivers several alerts as one notification. Notifiers without
+// native support receive a plain message listing each alert, one per
+// destination for notifiers that route alerts. When only some destinations
+// fail, the error is a PartialError.
+func SendGroup(n Notifier, triggered []alerts.TriggeredAlert) error {
+	if g, ok := n.(GroupNotifier); ok {
+		return g.SendAlerts(triggered)
+	}
+
+	r, ok := n.(RoutedNotifier)
+	if !ok {
+		return n.SendMessage(groupMessage(triggered))
+	}
+
+	var failed []int
+	var lastErr error
+	for _, group := range byDestination(r, triggered) {
+		title, message := groupMessage(group)
+		dest := r.Destination(group[0])
+		if err := r.SendMessageTo(dest, title, message); err != nil {
+			lastErr = err
+			for i, alert := range triggered {
+				if r.Destination(alert) == dest {
+					failed = append(failed, i)
+				}
+			}
+		}
+	}
+	sort.Ints(failed)
+	return partial(failed, len(triggered), lastErr)
+}
+
+// SendNotice delivers a notice about alert, to the alert's own destination
+// on notifiers that route alerts
+func SendNotice(n Notifier, alert alerts.TriggeredAlert, title, message string) error {
+	if r, ok := n.(RoutedNotifier); ok {
+		return r.SendMessageTo(r.Destination(alert), title, message)
+	}
+	return n.SendMessage(title, message)
+}
+
+// byDestination splits alerts by where r delivers them, keeping their order
+func byDestination(r RoutedNotifier, triggered []alerts.TriggeredAlert) [][]alerts.TriggeredAlert {
+	var groups [][]alerts.TriggeredAlert
+	index := make(map[string]int)
+	for _, alert := range triggered {
+		dest := r.Destination(alert)
+		if i, ok := index[dest]; ok {
+			groups[i] = append(groups[i], alert)
+			continue
+		}
+		index[dest] = len(groups)
+		groups = append(groups, []alerts.TriggeredAlert{alert})
+	}
+	return groups
+}
+
+// groupMessage lists several alerts in a plain message
+func groupMessage(triggered []alerts.TriggeredAlert) (string, string) {
+	var b strings.Builder
+	for _, alert := range triggered {
+		fmt.Fprintf(&b, "• %s\n", alert.Message)
+	}
+	return alerts.Summary(triggered), strings.TrimSuffix(b.String(), "\n")
+}
+
+// newHTTPClient returns the HTTP client shared by webhook notifiers
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+	}
+}
+
+// postJSON marshals payload and POSTs it to url, failing on non-2xx responses
+func postJSON(client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// sendWithRetry sends the request built by newReq, retrying rate-limited (429)
+// responses up to maxRetries times. retryAfter extracts the server's requested
+// delay from a 429 response body, returning 0 if none was given.
+func sendWithRetry(client *http.Client, maxRetries int, newReq func() (*http.Request, error), retryAfter func(body []byte) time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return fmt.Errorf("creating request: %w", err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("sending request: %w", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRetries {
+			return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+		}
+
+		wait := retryAfter(body)
+		if wait == 0 {
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(secs) * time.Second
+			}
+		}
+		if wait <= 0 {
+			wait = time.Duration(attempt+1) * time.Second
+		}
+		if wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+// alertTitle returns the headline shown for an alert
+func alertTitle(alert alerts.TriggeredAlert) string {
+	if alert.Title != "" {
+		return alert.Title
+	}
+	return fmt.Sprintf("%s %s Alert", directionEmoji(alert.Direction), alert.DisplayName())
+}
+
+// directionEmoji returns an emoji matching the alert direction
+func directionEmoji(direction string) string {
+	switch direction {
+	case "up":
+		return "📈"
+	case "down":
+		return "📉"
+	}
+	return "💰"
+}
+
+// directionColor returns an RGB color matching the alert direction
+func directionColor(direction string) int {
+	switch direction {
+	case "up":
+		return colorUp
+	case "down":
+		return colorDown
+	}
+	return colorNeutral
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+)
+
+// webhookServer is a local stand-in for a webhook endpoint. It records each
+// request body and answers with the queued status codes, then 200.
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	bodies   [][]byte
+	paths    []string
+	methods  []string
+	headers  []http.Header
+	statuses []int
+	reply    string
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	t.Helper()
+	w := &webhookServer{statuses: statuses}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		w.mu.Lock()
+		w.bodies = append(w.bodies, body)
+		w.paths = append(w.paths, r.URL.Path)
+		w.methods = append(w.methods, r.Method)
+		w.headers = append(w.headers, r.Header.Clone())
+		status := http.StatusOK
+		if len(w.statuses) > 0 {
+			status, w.statuses = w.statuses[0], w.statuses[1:]
+		}
+		reply := w.reply
+		w.mu.Unlock()
+
+		rw.WriteHeader(status)
+		io.WriteString(rw, reply)
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+// requests returns the number of requests received
+func (w *webhookServer) requests() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.bodies)
+}
+
+// decode unmarshals the i-th request body into v
+func (w *webhookServer) decode(t *testing.T, i int, v interface{}) {
+	t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if i >= len(w.bodies) {
+		t.Fatalf("got %d requests, want at least %d", len(w.bodies), i+1)
+	}
+	if err := json.Unmarshal(w.bodies[i], v); err != nil {
+		t.Fatalf("decoding request %d: %v\n%s", i, err, w.bodies[i])
+	}
+}
+
+// testAlert returns a triggered above alert for BTC-USD moving in direction
+func testAlert(direction string) alerts.TriggeredAlert {
+	cond := config.ConditionConfig{Type: "above", Value: 100000}
+	return alerts.TriggeredAlert{
+		Key:            "BTC-USD:above:100000.00",
+		Ticker:         "BTC-USD",
+		Name:           "Bitcoin",
+		Alert:          config.AlertConfig{Ticker: "BTC-USD", Name: "Bitcoin", Conditions: []config.ConditionConfig{cond}},
+		Condition:      cond,
+		Price:          102500,
+		ReferencePrice: 100000,
+		Direction:      direction,
+		Message:        "Bitcoin crossed above $100000.00",
+		Timestamp:      time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
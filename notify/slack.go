@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// Slack sends notifications to a Slack incoming webhook
+type Slack struct {
+	cfg        config.SlackConfig
+	httpClient *http.Client
+}
+
+// slackMessage represents the JSON payload for a Slack incoming webhook
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Username    string            `json:"username,omitempty"`
+	Channel     string            `json:"channel,omitempty"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+// slackAttachment wraps blocks so they get a colored sidebar
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string         `json:"type"`
+	Text     *slackText     `json:"text,omitempty"`
+	Fields   []slackText    `json:"fields,omitempty"`
+	Elements []slackElement `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackElement struct {
+	Type string    `json:"type"`
+	Text slackText `json:"text"`
+	URL  string    `json:"url"`
+}
+
+// NewSlack creates a new Slack notifier
+func NewSlack(cfg config.SlackConfig) *Slack {
+	return &Slack{
+		cfg:        cfg,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// Name identifies the notifier in logs
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+// SendMessage posts a plain text message
+func (s *Slack) SendMessage(title, message string) error {
+	msg := slackMessage{
+		Text:     fmt.Sprintf("*%s*\n%s", title, message),
+		Username: s.cfg.Username,
+		Channel:  s.cfg.Channel,
+	}
+
+	if err := postJSON(s.httpClient, s.cfg.WebhookURL, msg); err != nil {
+		return fmt.Errorf("sending slack message: %w", err)
+	}
+
+	return nil
+}
+
+// SendAlert posts an alert as a color-coded block message
+func (s *Slack) SendAlert(alert alerts.TriggeredAlert) error {
+	title := alertTitle(alert)
+
+	msg := slackMessage{
+		Text:     fmt.Sprintf("%s: %s", title, alert.Message),
+		Username: s.cfg.Username,
+		Channel:  s.cfg.Channel,
+		Attachments: []slackAttachment{{
+			Color: fmt.Sprintf("#%06X", directionColor(alert.Direction)),
+			Blocks: []slackBlock{
+				{
+					Type: "header",
+					Text: &slackText{Type: "plain_text", Text: title},
+				},
+				{
+					Type: "section",
+					Text: &slackText{Type: "mrkdwn", Text: alert.Message},
+				},
+				{
+					Type: "section",
+					Fields: []slackText{
+						{Type: "mrkdwn", Text: fmt.Sprintf("*Ticker*\n%s", alert.Ticker)},
+						{Type: "mrkdwn", Text: fmt.Sprintf("*Price*\n$%.2f", alert.Price)},
+						{Type: "mrkdwn", Text: fmt.Sprintf("*Condition*\n%s", alert.Condition.Describe())},
+						{Type: "mrkdwn", Text: fmt.Sprintf("*Change*\n%s", alert.ChangeText())},
+					},
+				},
+				{
+					Type: "actions",
+					Elements: []slackElement{{
+						Type: "button",
+						Text: slackText{Type: "plain_text", Text: "View chart"},
+						URL:  yahoo.QuoteURL(alert.Ticker),
+					}},
+				},
+			},
+		}},
+	}
+
+	if err := postJSON(s.httpClient, s.cfg.WebhookURL, msg); err != nil {
+		return fmt.Errorf("sending slack message: %w", err)
+	}
+
+	return nil
+}
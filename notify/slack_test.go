@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+func TestSlackSendAlert(t *testing.T) {
+	tests := []struct {
+		direction string
+		color     string
+	}{
+		{"up", "#2EB67D"},
+		{"down", "#E01E5A"},
+		{"", "#808080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			srv := newWebhookServer(t)
+			s := NewSlack(config.SlackConfig{WebhookURL: srv.URL, Username: "alerts", Channel: "#prices"})
+
+			if err := s.SendAlert(testAlert(tt.direction)); err != nil {
+				t.Fatalf("SendAlert: %v", err)
+			}
+
+			var msg slackMessage
+			srv.decode(t, 0, &msg)
+
+			if msg.Username != "alerts" || msg.Channel != "#prices" {
+				t.Errorf("username/channel = %q/%q, want alerts/#prices", msg.Username, msg.Channel)
+			}
+			if !strings.Contains(msg.Text, "Bitcoin crossed above $100000.00") {
+				t.Errorf("fallback text %q doesn't include the message", msg.Text)
+			}
+			if len(msg.Attachments) != 1 {
+				t.Fatalf("got %d attachments, want 1", len(msg.Attachments))
+			}
+			att := msg.Attachments[0]
+			if att.Color != tt.color {
+				t.Errorf("color = %s, want %s", att.Color, tt.color)
+			}
+
+			var types []string
+			for _, b := range att.Blocks {
+				types = append(types, b.Type)
+			}
+			if got := strings.Join(types, ","); got != "header,section,section,actions" {
+				t.Fatalf("blocks = %s, want header,section,section,actions", got)
+			}
+			if att.Blocks[0].Text.Text != alertTitle(testAlert(tt.direction)) {
+				t.Errorf("header = %q", att.Blocks[0].Text.Text)
+			}
+
+			fields := att.Blocks[2].Fields
+			want := []string{
+				"*Ticker*\nBTC-USD",
+				"*Price*\n$102500.00",
+				"*Condition*\nabove $100000.00",
+				"*Change*\n+2.50% (+$2500.00)",
+			}
+			if len(fields) != len(want) {
+				t.Fatalf("got %d fields, want %d", len(fields), len(want))
+			}
+			for i, f := range fields {
+				if f.Type != "mrkdwn" || f.Text != want[i] {
+					t.Errorf("field %d = %q (%s), want %q", i, f.Text, f.Type, want[i])
+				}
+			}
+
+			button := att.Blocks[3].Elements[0]
+			if button.Type != "button" || button.URL != yahoo.QuoteURL("BTC-USD") {
+				t.Errorf("chart button = %+v, want a button to %s", button, yahoo.QuoteURL("BTC-USD"))
+			}
+		})
+	}
+}
+
+func TestSlackSendMessage(t *testing.T) {
+	srv := newWebhookServer(t)
+	s := NewSlack(config.SlackConfig{WebhookURL: srv.URL})
+
+	if err := s.SendMessage("Digest", "BTC-USD $102500.00"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	var msg slackMessage
+	srv.decode(t, 0, &msg)
+	if msg.Text != "*Digest*\nBTC-USD $102500.00" {
+		t.Errorf("text = %q", msg.Text)
+	}
+	if len(msg.Attachments) != 0 {
+		t.Errorf("got %d attachments, want none", len(msg.Attachments))
+	}
+}
+
+func TestSlackErrors(t *testing.T) {
+	// Errors, including rate limiting, are returned without retrying so the
+	// outbox can retry the alert on a later run
+	for _, status := range []int{400, 404, 429, 500} {
+		srv := newWebhookServer(t, status)
+		srv.reply = "invalid_payload"
+		s := NewSlack(config.SlackConfig{WebhookURL: srv.URL})
+
+		err := s.SendAlert(testAlert("up"))
+		if err == nil {
+			t.Errorf("status %d: got no error", status)
+			continue
+		}
+		if !strings.Contains(err.Error(), "invalid_payload") {
+			t.Errorf("status %d: error %q doesn't include the response body", status, err)
+		}
+		if n := srv.requests(); n != 1 {
+			t.Errorf("status %d: got %d requests, want 1", status, n)
+		}
+	}
+}
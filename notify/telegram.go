@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/yahoo"
+)
+
+// Telegram sends notifications through the Telegram Bot API
+type Telegram struct {
+	cfg        config.TelegramConfig
+	httpClient *http.Client
+}
+
+// telegramMessage represents the sendMessage request payload
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+// telegramError represents an error response from the Bot API
+type telegramError struct {
+	Parameters struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// telegramEscaper escapes characters reserved by Telegram's MarkdownV2
+var telegramEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// NewTelegram creates a new Telegram notifier
+func NewTelegram(cfg config.TelegramConfig) *Telegram {
+	return &Telegram{
+		cfg:        cfg,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// Name identifies the notifier in logs
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+// Destination returns the chat an alert is sent to
+func (t *Telegram) Destination(alert alerts.TriggeredAlert) string {
+	if alert.Alert.TelegramChatID != "" {
+		return alert.Alert.TelegramChatID
+	}
+	return t.cfg.ChatID
+}
+
+// SendAlert sends an alert as a MarkdownV2 message to the alert's chat
+func (t *Telegram) SendAlert(alert alerts.TriggeredAlert) error {
+	return t.send(t.Destination(alert), telegramText(alert))
+}
+
+// SendMessage sends a plain notice to the default chat
+func (t *Telegram) SendMessage(title, message string) error {
+	return t.SendMessageTo(t.cfg.ChatID, title, message)
+}
+
+// SendMessageTo sends a plain notice to a chat
+func (t *Telegram) SendMessageTo(chatID, title, message string) error {
+	if chatID == "" {
+		return fmt.Errorf("telegram.chat_id is required for notices")
+	}
+	esc := telegramEscaper.Replace
+	return t.send(chatID, fmt.Sprintf("*%s*\n%s", esc(title), esc(message)))
+}
+
+// send posts MarkdownV2 text to a chat, retrying when rate limited
+func (t *Telegram) send(chatID, text string) error {
+	msg := telegramMessage{
+		ChatID:                chatID,
+		Text:                  text,
+		ParseMode:             "MarkdownV2",
+		DisableWebPagePreview: true,
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshaling telegram message: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(t.cfg.APIURL, "/"), t.cfg.BotToken)
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	if err := sendWithRetry(t.httpClient, t.cfg.MaxRetries, newReq, telegramRetryAfter); err != nil {
+		// Transport errors include the request URL, which embeds the bot token
+		redacted := strings.ReplaceAll(err.Error(), t.cfg.BotToken, "<token>")
+		return fmt.Errorf("sending telegram message: %s", redacted)
+	}
+
+	return nil
+}
+
+// telegramText formats an alert as MarkdownV2
+func telegramText(alert alerts.TriggeredAlert) string {
+	esc := telegramEscaper.Replace
+	link := strings.NewReplacer(`\`, `\\`, ")", `\)`).Replace(yahoo.QuoteURL(alert.Ticker))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*\n", esc(alertTitle(alert)))
+	fmt.Fprintf(&b, "%s\n\n", esc(alert.Message))
+	fmt.Fprintf(&b, "*Price:* `$%.2f`\n", alert.Price)
+	fmt.Fprintf(&b, "*Condition:* %s\n", esc(alert.Condition.Describe()))
+	fmt.Fprintf(&b, "*Change:* %s\n", esc(alert.ChangeText()))
+	fmt.Fprintf(&b, "[View chart](%s)", link)
+
+	return b.String()
+}
+
+// telegramRetryAfter reads the retry delay from a rate-limit response
+func telegramRetryAfter(body []byte) time.Duration {
+	var resp telegramError
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0
+	}
+	return time.Duration(resp.Parameters.RetryAfter) * time.Second
+}
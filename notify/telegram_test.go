@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+)
+
+// routedAlerts returns alerts for two per-alert chats and one without a chat
+func routedAlerts(t *testing.T) []alerts.TriggeredAlert {
+	t.Helper()
+	btc, eth, sol := testAlert("up"), testAlert("up"), testAlert("down")
+	btc.Alert.TelegramChatID, btc.Alert.MatrixRoomID = "-100btc", "!btc:example.com"
+	eth.Ticker, eth.Message = "ETH-USD", "Ethereum crossed above $4000.00"
+	eth.Alert.TelegramChatID, eth.Alert.MatrixRoomID = "-100eth", "!eth:example.com"
+	sol.Ticker, sol.Message = "SOL-USD", "Solana fell below $150.00"
+	sol.Alert.TelegramChatID, sol.Alert.MatrixRoomID = "-100btc", "!btc:example.com"
+	return []alerts.TriggeredAlert{btc, eth, sol}
+}
+
+func TestTelegramSendGroupRoutesByChat(t *testing.T) {
+	srv := newWebhookServer(t)
+	// No default chat: every alert sets its own
+	tg := NewTelegram(config.TelegramConfig{BotToken: "123:abc", APIURL: srv.URL})
+
+	if err := SendGroup(tg, routedAlerts(t)); err != nil {
+		t.Fatalf("SendGroup: %v", err)
+	}
+
+	if n := srv.requests(); n != 2 {
+		t.Fatalf("got %d messages, want one per chat", n)
+	}
+	texts := map[string]string{}
+	for i := 0; i < 2; i++ {
+		var msg telegramMessage
+		srv.decode(t, i, &msg)
+		texts[msg.ChatID] = msg.Text
+	}
+
+	btc := texts["-100btc"]
+	if !strings.Contains(btc, "Bitcoin crossed above") || !strings.Contains(btc, "Solana fell below") {
+		t.Errorf("-100btc got %q, want the BTC and SOL alerts", btc)
+	}
+	if eth := texts["-100eth"]; !strings.Contains(eth, "Ethereum crossed above") || strings.Contains(eth, "Bitcoin") {
+		t.Errorf("-100eth got %q, want only the ETH alert", eth)
+	}
+}
+
+func TestTelegramNotices(t *testing.T) {
+	srv := newWebhookServer(t)
+	tg := NewTelegram(config.TelegramConfig{BotToken: "123:abc", APIURL: srv.URL})
+
+	// Without a default chat, plain notices can't be sent, but notices
+	// about an alert go to its chat
+	if err := tg.SendMessage("Digest", "prices"); err == nil {
+		t.Error("SendMessage without a chat: got no error")
+	}
+	if err := SendNotice(tg, routedAlerts(t)[1], "⚠️ Alert not delivered", "Ethereum crossed above $4000.00"); err != nil {
+		t.Fatalf("SendNotice: %v", err)
+	}
+
+	var msg telegramMessage
+	srv.decode(t, 0, &msg)
+	if msg.ChatID != "-100eth" {
+		t.Errorf("notice sent to %q, want -100eth", msg.ChatID)
+	}
+}
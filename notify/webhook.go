@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+)
+
+// Headers set on every webhook request
+const (
+	webhookTimestampHeader = "X-Asset-Alerts-Timestamp"
+	webhookSignatureHeader = "X-Asset-Alerts-Signature"
+)
+
+// Webhook POSTs signed JSON alert documents to a configured URL
+type Webhook struct {
+	cfg        config.WebhookConfig
+	retryDelay time.Duration
+	httpClient *http.Client
+}
+
+// NewWebhook creates a new generic webhook notifier
+func NewWebhook(cfg config.WebhookConfig) *Webhook {
+	delay, err := time.ParseDuration(cfg.RetryDelay)
+	if err != nil {
+		delay = 2 * time.Second
+	}
+
+	return &Webhook{
+		cfg:        cfg,
+		retryDelay: delay,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// Name identifies the notifier in logs
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// SendAlert POSTs the alert document, retrying transient failures with backoff
+func (w *Webhook) SendAlert(alert alerts.TriggeredAlert) error {
+	return w.deliver(newAlertDocument(alert))
+}
+
+// SendAlerts POSTs a single group document containing every alert
+func (w *Webhook) SendAlerts(triggered []alerts.TriggeredAlert) error {
+	return w.deliver(newGroupDocument(triggered))
+}
+
+// SendMessage POSTs a notice document
+func (w *Webhook) SendMessage(title, message string) error {
+	return w.deliver(newNoticeDocument(title, message))
+}
+
+// deliver POSTs a document, retrying transient failures with backoff
+func (w *Webhook) deliver(doc interface{}) error {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshaling webhook payload: %w", err)
+	}
+
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		retryable, err := w.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= w.cfg.MaxRetries {
+			return fmt.Errorf("sending webhook: %w", err)
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post makes a single signed delivery attempt. The returned bool reports
+// whether a failure is worth retrying (network errors, 429 and 5xx).
+func (w *Webhook) post(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("creating request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+sign(w.cfg.Secret, timestamp, body))
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return false, nil
+}
+
+// sign computes the hex HMAC-SHA256 of "<timestamp>.<body>" so receivers can
+// verify both the payload and its freshness
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
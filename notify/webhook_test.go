@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/config"
+)
+
+func newTestWebhook(url string) *Webhook {
+	return NewWebhook(config.WebhookConfig{URL: url, Secret: "shared-secret", MaxRetries: 2, RetryDelay: "1ms"})
+}
+
+func TestWebhookSignature(t *testing.T) {
+	srv := newWebhookServer(t)
+	if err := newTestWebhook(srv.URL).SendAlert(testAlert("up")); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+
+	header := srv.headers[0]
+	timestamp := header.Get("X-Asset-Alerts-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Fatalf("timestamp header = %q, want the current Unix time", timestamp)
+	}
+
+	// What a receiver does: HMAC "<timestamp>.<body>" with the shared secret
+	mac := hmac.New(sha256.New, []byte("shared-secret"))
+	mac.Write([]byte(timestamp + "." + string(srv.bodies[0])))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := header.Get("X-Asset-Alerts-Signature"); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if ct := header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type = %q", ct)
+	}
+}
+
+func TestWebhookAlertDocument(t *testing.T) {
+	srv := newWebhookServer(t)
+	alert := testAlert("up")
+	alert.Condition = config.ConditionConfig{Type: "percent_change", Value: 5, Period: "24h"}
+	if err := newTestWebhook(srv.URL).SendAlert(alert); err != nil {
+		t.Fatalf("SendAlert: %v", err)
+	}
+
+	var doc map[string]interface{}
+	srv.decode(t, 0, &doc)
+	want := map[string]interface{}{
+		"version":         1.0,
+		"type":            "alert",
+		"ticker":          "BTC-USD",
+		"name":            "Bitcoin",
+		"price":           102500.0,
+		"reference_price": 100000.0,
+		"direction":       "up",
+		"message":         "Bitcoin crossed above $100000.00",
+		"timestamp":       "2025-03-01T12:00:00Z",
+	}
+	for field, value := range want {
+		if doc[field] != value {
+			t.Errorf("%s = %#v, want %#v", field, doc[field], value)
+		}
+	}
+	cond, _ := doc["condition"].(map[string]interface{})
+	if cond["type"] != "percent_change" || cond["value"] != 5.0 || cond["period"] != "24h" {
+		t.Errorf("condition = %#v", doc["condition"])
+	}
+
+	// An unknown reference price is null rather than 0
+	srv = newWebhookServer(t)
+	alert.ReferencePrice = 0
+	newTestWebhook(srv.URL).SendAlert(alert)
+	if !strings.Contains(string(srv.bodies[0]), `"reference_price":null`) {
+		t.Errorf("body = %s, want a null reference_price", srv.bodies[0])
+	}
+}
+
+func TestWebhookGroupAndNoticeDocuments(t *testing.T) {
+	srv := newWebhookServer(t)
+	w := newTestWebhook(srv.URL)
+	if err := w.SendAlerts(routedAlerts(t)); err != nil {
+		t.Fatalf("SendAlerts: %v", err)
+	}
+	if err := w.SendMessage("Digest", "prices"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	var group groupDocument
+	srv.decode(t, 0, &group)
+	if group.Version != 1 || group.Type != "group" || len(group.Alerts) != 3 || group.Alerts[1].Ticker != "ETH-USD" {
+		t.Errorf("group = %+v", group)
+	}
+	var notice noticeDocument
+	srv.decode(t, 1, &notice)
+	if notice.Type != "notice" || notice.Title != "Digest" || notice.Message != "prices" {
+		t.Errorf("notice = %+v", notice)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		statuses []int
+		requests int
+		ok       bool
+	}{
+		{statuses: []int{500, 503}, requests: 3, ok: true},
+		{statuses: []int{429}, requests: 2, ok: true},
+		{statuses: []int{502, 502, 502}, requests: 3},
+		{statuses: []int{400}, requests: 1},
+		{statuses: []int{404}, requests: 1},
+	}
+
+	for _, tt := range tests {
+		srv := newWebhookServer(t, tt.statuses...)
+		err := newTestWebhook(srv.URL).SendAlert(testAlert("up"))
+		if (err == nil) != tt.ok {
+			t.Errorf("statuses %v: error = %v, want ok = %v", tt.statuses, err, tt.ok)
+		}
+		if n := srv.requests(); n != tt.requests {
+			t.Errorf("statuses %v: got %d requests, want %d", tt.statuses, n, tt.requests)
+		}
+		// Every retry is signed afresh
+		for i, h := range srv.headers {
+			if !strings.HasPrefix(h.Get("X-Asset-Alerts-Signature"), "sha256=") {
+				t.Errorf("statuses %v: request %d unsigned", tt.statuses, i)
+			}
+		}
+	}
+}
@@ -5,18 +5,34 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/callback"
+	"github.com/vcavallo/asset-alerts/chart"
 	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/state"
+	"github.com/vcavallo/asset-alerts/yahoo"
 )
 
 // Sender sends notifications to ntfy
 type Sender struct {
-	cfg        config.NtfyConfig
-	httpClient *http.Client
+	cfg            config.NtfyConfig
+	callbackURL    string
+	callbackSecret string
+	state          *state.State
+	httpClient     *http.Client
 }
 
+// chartWindow is how much price history chart attachments show
+const chartWindow = 24 * time.Hour
+
 // notification represents the JSON payload for ntfy
 type notification struct {
 	Topic    string   `json:"topic"`
@@ -24,6 +40,20 @@ type notification struct {
 	Title    string   `json:"title,omitempty"`
 	Priority int      `json:"priority,omitempty"`
 	Tags     []string `json:"tags,omitempty"`
+	Icon     string   `json:"icon,omitempty"`
+	Click    string   `json:"click,omitempty"`
+	Markdown bool     `json:"markdown,omitempty"`
+	Actions  []action `json:"actions,omitempty"`
+}
+
+// action represents an ntfy action button
+type action struct {
+	Action  string            `json:"action"` // "view" or "http"
+	Label   string            `json:"label"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Clear   bool              `json:"clear,omitempty"`
 }
 
 // NewSender creates a new ntfy sender
@@ -36,23 +66,46 @@ func NewSender(cfg config.NtfyConfig) *Sender {
 	}
 }
 
+// WithCallback enables snooze and acknowledge action buttons that call back
+// into the daemon's callback server at baseURL, through links signed with
+// secret. An empty baseURL disables them.
+func (s *Sender) WithCallback(baseURL, secret string) *Sender {
+	s.callbackURL = strings.TrimRight(baseURL, "/")
+	s.callbackSecret = secret
+	return s
+}
+
+// WithState gives the sender access to price history for chart attachments
+func (s *Sender) WithState(st *state.State) *Sender {
+	s.state = st
+	return s
+}
+
 // Send sends a notification to ntfy
 func (s *Sender) Send(title, message string, tags []string) error {
-	notif := notification{
-		Topic:    s.cfg.Topic,
+	return s.send(s.cfg, s.newNotification(s.cfg, title, message, tags))
+}
+
+// newNotification builds a notification using the given (possibly overridden) settings
+func (s *Sender) newNotification(cfg config.NtfyConfig, title, message string, tags []string) notification {
+	return notification{
+		Topic:    cfg.Topic,
 		Message:  message,
 		Title:    title,
-		Priority: s.cfg.Priority,
-		Tags:     tags,
+		Priority: cfg.Priority,
+		Tags:     append(tags, cfg.Tags...),
+		Icon:     cfg.Icon,
 	}
+}
 
+// send publishes a notification to the configured server
+func (s *Sender) send(cfg config.NtfyConfig, notif notification) error {
 	body, err := json.Marshal(notif)
 	if err != nil {
 		return fmt.Errorf("marshaling notification: %w", err)
 	}
 
-	url := s.cfg.Server
-	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	req, err := http.NewRequest("POST", cfg.Server, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("creating request: %w", err)
 	}
@@ -60,7 +113,7 @@ func (s *Sender) Send(title, message string, tags []string) error {
 	req.Header.Set("Content-Type", "application/json")
 
 	// Add authentication
-	s.addAuth(req)
+	addAuth(req, cfg)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -77,28 +130,280 @@ func (s *Sender) Send(title, message string, tags []string) error {
 }
 
 // addAuth adds authentication headers based on configuration
-func (s *Sender) addAuth(req *http.Request) {
+func addAuth(req *http.Request, cfg config.NtfyConfig) {
 	// Token auth takes precedence
-	if s.cfg.Token != "" {
-		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
 		return
 	}
 
 	// Basic auth
-	if s.cfg.Username != "" && s.cfg.Password != "" {
-		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	if cfg.Username != "" && cfg.Password != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+}
+
+// Name identifies the notifier in logs
+func (s *Sender) Name() string {
+	return "ntfy"
+}
+
+// SendMessage sends a plain notification
+func (s *Sender) SendMessage(title, message string) error {
+	return s.Send(title, message, nil)
+}
+
+// SendAlert sends an alert notification with appropriate formatting,
+// applying any per-alert and per-condition overrides
+func (s *Sender) SendAlert(alert alerts.TriggeredAlert) error {
+	cfg := s.cfg.WithOverrides(alert.Alert.Ntfy, alert.Condition.Ntfy)
+
+	title := alert.Title
+	if title == "" {
+		title = fmt.Sprintf("%s Alert", alert.DisplayName())
+	}
+
+	// Use emoji tags for visual identification; ntfy shows them before the title
+	tags := append(directionTags(alert), alert.Ticker)
+
+	message := alert.Message
+	if cfg.Markdown {
+		message = markdownBody(alert)
+	}
+
+	notif := s.newNotification(cfg, title, message, tags)
+	notif.Markdown = cfg.Markdown
+	notif.Click = clickURL(cfg.Click, alert.Ticker)
+	notif.Actions = s.actions(alert)
+
+	if alert.Alert.Chart {
+		if img, err := s.renderChart(alert); err != nil {
+			log.Printf("Skipping chart for %s: %v", alert.Ticker, err)
+		} else if err := s.sendAttachment(cfg, notif, alert.Ticker+".png", img); err != nil {
+			// Servers without attachment support reject uploads; send the plain notification instead
+			log.Printf("Chart attachment rejected for %s, sending without it: %v", alert.Ticker, err)
+		} else {
+			return nil
+		}
+	}
+
+	return s.send(cfg, notif)
+}
+
+// SendAlerts sends several alerts as one notification per ntfy destination.
+// Each notification uses the highest priority of the alerts it contains.
+func (s *Sender) SendAlerts(triggered []alerts.TriggeredAlert) error {
+	type destination struct{ server, topic string }
+
+	var order []destination
+	groups := make(map[destination][]alerts.TriggeredAlert)
+	configs := make(map[destination]config.NtfyConfig)
+	for _, alert := range triggered {
+		cfg := s.cfg.WithOverrides(alert.Alert.Ntfy, alert.Condition.Ntfy)
+		dest := destination{cfg.Server, cfg.Topic}
+
+		if prev, ok := configs[dest]; !ok {
+			order = append(order, dest)
+			configs[dest] = cfg
+		} else if cfg.Priority > prev.Priority {
+			prev.Priority = cfg.Priority
+			configs[dest] = prev
+		}
+		groups[dest] = append(groups[dest], alert)
+	}
+
+	for _, dest := range order {
+		if err := s.sendGroup(configs[dest], groups[dest]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendGroup publishes one notification summarizing the alerts
+func (s *Sender) sendGroup(cfg config.NtfyConfig, group []alerts.TriggeredAlert) error {
+	if len(group) == 1 {
+		return s.SendAlert(group[0])
+	}
+
+	var b strings.Builder
+	if cfg.Markdown {
+		b.WriteString("| Ticker | Price | Change |\n|---|---|---|\n")
+		for _, alert := range group {
+			fmt.Fprintf(&b, "| %s | $%.2f | %s |\n", alert.DisplayName(), alert.Price, alert.ChangeText())
+		}
+	} else {
+		for _, alert := range group {
+			fmt.Fprintf(&b, "• %s\n", alert.Message)
+		}
+	}
+
+	notif := s.newNotification(cfg, alerts.Summary(group), strings.TrimSuffix(b.String(), "\n"), groupTags(group))
+	notif.Markdown = cfg.Markdown
+
+	return s.send(cfg, notif)
+}
+
+// groupTags returns a trend tag when every alert moved the same way
+func groupTags(group []alerts.TriggeredAlert) []string {
+	for _, alert := range group[1:] {
+		if alert.Direction != group[0].Direction {
+			return []string{"bar_chart"}
+		}
+	}
+	if group[0].Direction == "down" {
+		return []string{"chart_with_downwards_trend"}
+	}
+	return []string{"chart_with_upwards_trend"}
+}
+
+// directionTags returns emoji tags for the alert: trend charts for threshold
+// crossings, plus a lightning bolt for volatility (change) alerts
+func directionTags(alert alerts.TriggeredAlert) []string {
+	trend := "chart_with_upwards_trend"
+	if alert.Direction == "down" {
+		trend = "chart_with_downwards_trend"
+	}
+
+	switch alert.Condition.Type {
+	case "percent_change", "absolute_change":
+		return []string{"zap", trend}
+	}
+	return []string{trend}
+}
+
+// clickURL resolves the click setting to the URL opened when the notification is tapped
+func clickURL(setting, ticker string) string {
+	switch setting {
+	case "", "quote":
+		return yahoo.QuoteURL(ticker)
+	case "none":
+		return ""
+	}
+	return strings.ReplaceAll(setting, "{ticker}", url.PathEscape(ticker))
+}
+
+// markdownBody renders the alert message followed by a price/threshold/change table
+func markdownBody(alert alerts.TriggeredAlert) string {
+	threshold := alert.Condition.Describe()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**\n\n", alert.Message)
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Price | $%.2f |\n", alert.Price)
+	fmt.Fprintf(&b, "| Threshold | %s |\n", threshold)
+	fmt.Fprintf(&b, "| Change | %s |\n", alert.ChangeText())
+
+	return b.String()
+}
+
+// renderChart draws a sparkline of recent history with the alert's threshold
+func (s *Sender) renderChart(alert alerts.TriggeredAlert) ([]byte, error) {
+	if s.state == nil {
+		return nil, fmt.Errorf("no price history available")
+	}
+
+	// Alerts are sent without the state lock held
+	s.state.Lock()
+	history := s.state.GetHistory(alert.Ticker, chartWindow)
+	s.state.Unlock()
+
+	var prices []float64
+	for _, record := range history {
+		prices = append(prices, record.Price)
+	}
+	prices = append(prices, alert.Price)
+
+	threshold := alert.ReferencePrice
+	if alert.Condition.Type == "above" || alert.Condition.Type == "below" {
+		threshold = alert.Condition.Value
 	}
+
+	return chart.Sparkline(prices, threshold)
 }
 
-// SendAlert sends an alert notification with appropriate formatting
-func (s *Sender) SendAlert(ticker, name, message string) error {
-	title := fmt.Sprintf("💰 %s Alert", name)
-	if name == "" {
-		title = fmt.Sprintf("💰 %s Alert", ticker)
+// sendAttachment publishes a notification with a file attached by PUTting
+// the file to the topic and passing the other fields as headers
+func (s *Sender) sendAttachment(cfg config.NtfyConfig, notif notification, filename string, data []byte) error {
+	endpoint := strings.TrimRight(cfg.Server, "/") + "/" + notif.Topic
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
 	}
 
-	// Use emoji tags for visual identification
-	tags := []string{"chart_with_upwards_trend", ticker}
+	req.Header.Set("X-Filename", filename)
+	req.Header.Set("X-Title", mime.BEncoding.Encode("utf-8", notif.Title))
+	req.Header.Set("X-Message", mime.BEncoding.Encode("utf-8", notif.Message))
+	if notif.Markdown {
+		req.Header.Set("X-Markdown", "yes")
+	}
+	if notif.Click != "" {
+		req.Header.Set("X-Click", notif.Click)
+	}
+	if notif.Priority != 0 {
+		req.Header.Set("X-Priority", strconv.Itoa(notif.Priority))
+	}
+	if len(notif.Tags) > 0 {
+		req.Header.Set("X-Tags", strings.Join(notif.Tags, ","))
+	}
+	if notif.Icon != "" {
+		req.Header.Set("X-Icon", notif.Icon)
+	}
+	if len(notif.Actions) > 0 {
+		actions, err := json.Marshal(notif.Actions)
+		if err != nil {
+			return fmt.Errorf("marshaling actions: %w", err)
+		}
+		req.Header.Set("X-Actions", string(actions))
+	}
+
+	addAuth(req, cfg)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ntfy returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// actions returns the buttons attached to an alert: a chart link, plus
+// snooze and acknowledge callbacks when the callback server is configured
+func (s *Sender) actions(alert alerts.TriggeredAlert) []action {
+	actions := []action{{
+		Action: "view",
+		Label:  "View chart",
+		URL:    yahoo.QuoteURL(alert.Ticker),
+	}}
+
+	if s.callbackURL == "" || alert.Key == "" {
+		return actions
+	}
+
+	expires := time.Now().Add(callback.LinkTTL)
+	actions = append(actions,
+		action{
+			Action: "http",
+			Label:  "Snooze 1h",
+			URL:    callback.SignedURL(s.callbackURL, s.callbackSecret, "/snooze", alert.Key, url.Values{"for": {"1h"}}, expires),
+			Method: "POST",
+			Clear:  true,
+		},
+		action{
+			Action: "http",
+			Label:  "Acknowledge",
+			URL:    callback.SignedURL(s.callbackURL, s.callbackSecret, "/ack", alert.Key, nil, expires),
+			Method: "POST",
+			Clear:  true,
+		},
+	)
 
-	return s.Send(title, message, tags)
+	return actions
 }
@@ -0,0 +1,445 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/notify"
+	"github.com/vcavallo/asset-alerts/state"
+)
+
+// Outbox queues triggered alerts in state and delivers them to every
+// notifier, retrying failures with backoff on later runs until they are
+// delivered or expire
+type Outbox struct {
+	cfg        *config.Config
+	st         *state.State
+	notifiers  []notify.Notifier
+	maxAge     time.Duration
+	backoff    time.Duration
+	maxBackoff time.Duration
+	verbose    bool
+}
+
+// pendingAlert is a decoded copy of an outbox entry
+type pendingAlert struct {
+	entry *state.OutboxEntry
+	alert alerts.TriggeredAlert
+}
+
+// New creates an outbox backed by st that groups and holds alerts according
+// to cfg. Durations are expected to have been validated by config.Load.
+func New(cfg *config.Config, st *state.State, notifiers []notify.Notifier, verbose bool) *Outbox {
+	maxAge, _ := time.ParseDuration(cfg.Outbox.MaxAge)
+	backoff, _ := time.ParseDuration(cfg.Outbox.Backoff)
+	maxBackoff, _ := time.ParseDuration(cfg.Outbox.MaxBackoff)
+
+	return &Outbox{
+		cfg:        cfg,
+		st:         st,
+		notifiers:  notifiers,
+		maxAge:     maxAge,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		verbose:    verbose,
+	}
+}
+
+// Enqueue adds triggered alerts to the outbox, pending on every notifier.
+// The caller must hold the state lock.
+func (o *Outbox) Enqueue(triggered []alerts.TriggeredAlert) error {
+	names := make([]string, 0, len(o.notifiers))
+	for _, n := range o.notifiers {
+		names = append(names, n.Name())
+	}
+
+	now := time.Now()
+	for _, alert := range triggered {
+		data, err := json.Marshal(queue(alert))
+		if err != nil {
+			return fmt.Errorf("serializing alert %s: %w", alert.Key, err)
+		}
+
+		o.st.Outbox = append(o.st.Outbox, state.OutboxEntry{
+			ID:          fmt.Sprintf("%s@%d", alert.Key, alert.Timestamp.UnixNano()),
+			Alert:       data,
+			Pending:     append([]string(nil), names...),
+			CreatedAt:   now,
+			NextAttempt: now,
+		})
+	}
+
+	return nil
+}
+
+// Flush attempts delivery of every entry that is due, then drops entries
+// that were delivered, acknowledged or have expired. The caller must not hold
+// the state lock: Flush takes it only to read and update the queue, so that
+// callback requests aren't blocked while notifiers send or back off.
+func (o *Outbox) Flush() {
+	now := time.Now()
+
+	o.st.Lock()
+	due, expired := o.collect(now)
+	o.st.Unlock()
+
+	for _, p := range expired {
+		o.expire(p.entry, p.alert)
+	}
+
+	failed := make(map[*state.OutboxEntry]string)
+	held := make(map[*state.OutboxEntry]time.Time)
+	for _, n := range o.notifiers {
+		o.deliver(n, due, now, failed, held)
+	}
+
+	for entry, lastErr := range failed {
+		entry.Attempts++
+		entry.LastError = lastErr
+		entry.NextAttempt = now.Add(o.delay(entry.Attempts))
+		if o.verbose {
+			log.Printf("Will retry %s via %s at %s", entry.ID, strings.Join(entry.Pending, ", "),
+				entry.NextAttempt.Format(time.RFC3339))
+		}
+	}
+
+	// Held alerts are retried when their quiet hours end, unless a failed
+	// delivery is retried sooner
+	for entry, until := range held {
+		entry.HeldUntil = until
+		if _, ok := failed[entry]; !ok || until.Before(entry.NextAttempt) {
+			entry.NextAttempt = until
+		}
+	}
+
+	o.st.Lock()
+	defer o.st.Unlock()
+
+	// Apply the results to the queue, which only Enqueue adds to, then keep
+	// only entries that still have notifiers to deliver to
+	delivered := make(map[string]*state.OutboxEntry, len(due))
+	for _, p := range due {
+		delivered[p.entry.ID] = p.entry
+	}
+	remaining := o.st.Outbox[:0]
+	for _, entry := range o.st.Outbox {
+		if updated, ok := delivered[entry.ID]; ok {
+			entry = *updated
+		}
+		if len(entry.Pending) > 0 {
+			remaining = append(remaining, entry)
+		}
+	}
+	o.st.Outbox = remaining
+}
+
+// collect returns copies of the entries that are due for delivery and of the
+// entries that have expired, and clears the expired, acknowledged and
+// unreadable entries from the queue. The caller must hold the state lock.
+func (o *Outbox) collect(now time.Time) (due, expired []pendingAlert) {
+	for i := range o.st.Outbox {
+		entry := &o.st.Outbox[i]
+		if entry.NextAttempt.After(now) {
+			continue
+		}
+
+		var q queuedAlert
+		if err := json.Unmarshal(entry.Alert, &q); err != nil {
+			log.Printf("Dropping unreadable outbox entry %s: %v", entry.ID, err)
+			entry.Pending = nil
+			continue
+		}
+		alert := o.restore(q)
+
+		if o.st.IsAcknowledged(alert.Key) {
+			if o.verbose {
+				log.Printf("Dropping acknowledged alert %s from outbox", entry.ID)
+			}
+			entry.Pending = nil
+			continue
+		}
+
+		copied := *entry
+		copied.Pending = append([]string(nil), entry.Pending...)
+		p := pendingAlert{entry: &copied, alert: alert}
+
+		// Time spent held by quiet hours doesn't count toward expiry
+		start := entry.CreatedAt
+		if entry.HeldUntil.After(start) {
+			start = entry.HeldUntil
+		}
+		if now.Sub(start) > o.maxAge {
+			expired = append(expired, p)
+			entry.Pending = nil
+			continue
+		}
+
+		due = append(due, p)
+	}
+
+	return due, expired
+}
+
+// Len returns the number of alerts awaiting delivery. The caller must hold
+// the state lock.
+func (o *Outbox) Len() int {
+	return len(o.st.Outbox)
+}
+
+// deliver sends the due alerts still pending on n, recording failures and
+// alerts held back by quiet hours
+func (o *Outbox) deliver(n notify.Notifier, due []pendingAlert, now time.Time, failed map[*state.OutboxEntry]string, held map[*state.OutboxEntry]time.Time) {
+	var batch, released []pendingAlert
+	for _, p := range due {
+		if !contains(p.entry.Pending, n.Name()) {
+			continue
+		}
+
+		if until, ok := o.heldUntil(n, p.alert, now); ok {
+			if o.verbose {
+				log.Printf("Holding alert %s for %s until %s (quiet hours)", p.entry.ID, n.Name(), until.Format(time.RFC3339))
+			}
+			if until.After(held[p.entry]) {
+				held[p.entry] = until
+			}
+			continue
+		}
+
+		if !p.entry.HeldUntil.IsZero() {
+			released = append(released, p)
+			continue
+		}
+		batch = append(batch, p)
+	}
+
+	b, batched := n.(notify.BatchNotifier)
+	batched = batched && b.Batched()
+
+	// Alerts held during quiet hours are delivered together when they end
+	if !batched && len(released) > 1 && len(released) <= o.cfg.Grouping.MaxSize {
+		o.deliverGroup(n, released, failed)
+	} else {
+		batch = append(released, batch...)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if batched {
+		if o.verbose {
+			log.Printf("Sending %d alerts via %s", len(batch), n.Name())
+		}
+
+		triggered := make([]alerts.TriggeredAlert, 0, len(batch))
+		for _, p := range batch {
+			triggered = append(triggered, p.alert)
+		}
+
+		err := b.SendAlerts(triggered)
+		if err != nil {
+			log.Printf("Failed to send alerts via %s: %v", n.Name(), err)
+		} else {
+			fmt.Printf("✓ %d alerts sent via %s\n", len(batch), n.Name())
+		}
+		record(n, batch, err, failed)
+		return
+	}
+
+	for _, group := range o.group(batch) {
+		// Large groups would be unreadable as one notification
+		if len(group) > 1 && len(group) <= o.cfg.Grouping.MaxSize {
+			o.deliverGroup(n, group, failed)
+			continue
+		}
+		for _, p := range group {
+			o.deliverOne(n, p, failed)
+		}
+	}
+}
+
+// deliverOne sends a single alert via n
+func (o *Outbox) deliverOne(n notify.Notifier, p pendingAlert, failed map[*state.OutboxEntry]string) {
+	alert := p.alert
+	if o.verbose {
+		log.Printf("Sending alert via %s: %s - %s", n.Name(), alert.Ticker, alert.Message)
+	}
+
+	if err := n.SendAlert(alert); err != nil {
+		log.Printf("Failed to send alert for %s via %s: %v", alert.Ticker, n.Name(), err)
+		failed[p.entry] = fmt.Sprintf("%s: %v", n.Name(), err)
+		return
+	}
+
+	fmt.Printf("✓ Alert sent via %s: %s - %s\n", n.Name(), alert.Name, alert.Message)
+	p.entry.Pending = remove(p.entry.Pending, n.Name())
+}
+
+// deliverGroup sends alerts as one combined notification via n, or one per
+// destination for notifiers that route alerts to different chats or rooms
+func (o *Outbox) deliverGroup(n notify.Notifier, group []pendingAlert, failed map[*state.OutboxEntry]string) {
+	for _, g := range byDestination(n, group) {
+		if len(g) == 1 {
+			o.deliverOne(n, g[0], failed)
+			continue
+		}
+		o.sendGroup(n, g, failed)
+	}
+}
+
+// sendGroup sends alerts as one combined notification via n
+func (o *Outbox) sendGroup(n notify.Notifier, group []pendingAlert, failed map[*state.OutboxEntry]string) {
+	triggered := make([]alerts.TriggeredAlert, 0, len(group))
+	for _, p := range group {
+		triggered = append(triggered, p.alert)
+	}
+
+	title := alerts.Summary(triggered)
+	if o.verbose {
+		log.Printf("Sending grouped alert via %s: %s", n.Name(), title)
+	}
+
+	err := notify.SendGroup(n, triggered)
+	if err != nil {
+		log.Printf("Failed to send grouped alert via %s: %v", n.Name(), err)
+	} else {
+		fmt.Printf("✓ Alerts sent via %s: %s\n", n.Name(), title)
+	}
+	record(n, group, err, failed)
+}
+
+// record applies the result of sending alerts together via n: alerts that
+// were delivered are no longer pending on n, and the rest are failed. A
+// notify.PartialError names the alerts that weren't delivered; any other
+// error fails them all.
+func record(n notify.Notifier, sent []pendingAlert, err error, failed map[*state.OutboxEntry]string) {
+	undelivered := make(map[int]bool)
+	var partial *notify.PartialError
+	if errors.As(err, &partial) {
+		for _, i := range partial.Failed {
+			undelivered[i] = true
+		}
+	}
+
+	for i, p := range sent {
+		if err != nil && (partial == nil || undelivered[i]) {
+			failed[p.entry] = fmt.Sprintf("%s: %v", n.Name(), err)
+			continue
+		}
+		p.entry.Pending = remove(p.entry.Pending, n.Name())
+	}
+}
+
+// group splits alerts according to the grouping mode, keeping their order
+func (o *Outbox) group(batch []pendingAlert) [][]pendingAlert {
+	switch o.cfg.Grouping.Mode {
+	case "run":
+		return [][]pendingAlert{batch}
+	case "group":
+		var result [][]pendingAlert
+		index := make(map[string]int)
+		for _, p := range batch {
+			label := p.alert.Alert.Group
+			if i, ok := index[label]; ok {
+				result[i] = append(result[i], p)
+				continue
+			}
+			// Alerts without a group are sent on their own
+			if label != "" {
+				index[label] = len(result)
+			}
+			result = append(result, []pendingAlert{p})
+		}
+		return result
+	}
+
+	result := make([][]pendingAlert, 0, len(batch))
+	for _, p := range batch {
+		result = append(result, []pendingAlert{p})
+	}
+	return result
+}
+
+// byDestination splits alerts by where n delivers them, keeping their order.
+// Notifiers that don't route alerts get a single group.
+func byDestination(n notify.Notifier, batch []pendingAlert) [][]pendingAlert {
+	r, ok := n.(notify.RoutedNotifier)
+	if !ok {
+		return [][]pendingAlert{batch}
+	}
+
+	var result [][]pendingAlert
+	index := make(map[string]int)
+	for _, p := range batch {
+		dest := r.Destination(p.alert)
+		if i, ok := index[dest]; ok {
+			result[i] = append(result[i], p)
+			continue
+		}
+		index[dest] = len(result)
+		result = append(result, []pendingAlert{p})
+	}
+	return result
+}
+
+// heldUntil reports whether quiet hours hold back alert on n and, if so, until when
+func (o *Outbox) heldUntil(n notify.Notifier, alert alerts.TriggeredAlert, now time.Time) (time.Time, bool) {
+	priority := o.cfg.Priority(alert.Alert, alert.Condition)
+	return o.cfg.QuietUntil(n.Name(), priority, alert.Alert.QuietHours, now)
+}
+
+// expire gives up on an entry, telling the notifiers it was still pending on
+// which alert they lost. Notifiers that delivered it aren't told.
+func (o *Outbox) expire(entry *state.OutboxEntry, alert alerts.TriggeredAlert) {
+	log.Printf("Giving up on alert %s after %d attempts (pending: %s, last error: %s)",
+		entry.ID, entry.Attempts, strings.Join(entry.Pending, ", "), entry.LastError)
+
+	title := "⚠️ Alert not delivered"
+	message := fmt.Sprintf("Gave up delivering this alert via %s after %d attempts over %s:\n%s",
+		strings.Join(entry.Pending, ", "), entry.Attempts, o.maxAge, alert.Message)
+
+	for _, n := range o.notifiers {
+		if !contains(entry.Pending, n.Name()) {
+			continue
+		}
+		if err := notify.SendNotice(n, alert, title, message); err != nil && o.verbose {
+			log.Printf("Failed to send expiry notice via %s: %v", n.Name(), err)
+		}
+	}
+}
+
+// delay returns the backoff before retry number attempts, doubling each time
+func (o *Outbox) delay(attempts int) time.Duration {
+	d := o.backoff
+	for i := 1; i < attempts && d < o.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.maxBackoff {
+		d = o.maxBackoff
+	}
+	return d
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(names []string, name string) []string {
+	var kept []string
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,352 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+	"github.com/vcavallo/asset-alerts/notify"
+	"github.com/vcavallo/asset-alerts/state"
+)
+
+// recorder is a notifier that records what it is sent
+type recorder struct {
+	name     string
+	alerts   []alerts.TriggeredAlert
+	messages []string
+	err      error
+}
+
+func (r *recorder) Name() string { return r.name }
+
+func (r *recorder) SendAlert(alert alerts.TriggeredAlert) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func (r *recorder) SendMessage(title, message string) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.messages = append(r.messages, title+": "+message)
+	return nil
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Ntfy:     config.NtfyConfig{Server: "https://ntfy.example.com", Topic: "prices", Username: "me", Password: "global-secret"},
+		Outbox:   config.OutboxConfig{MaxAge: "24h", Backoff: "1m", MaxBackoff: "1h"},
+		Grouping: config.GroupingConfig{Mode: "none", MaxSize: 10},
+		Alerts: []config.AlertConfig{{
+			Ticker:         "BTC-USD",
+			Name:           "Bitcoin",
+			TelegramChatID: "-100123",
+			Ntfy:           &config.NtfyOverride{Topic: "crypto", Token: "tk_override_secret"},
+			Conditions: []config.ConditionConfig{{
+				Type:  "above",
+				Value: 100000,
+				Ntfy:  &config.NtfyOverride{Priority: 5, Tags: []string{"rocket"}, Password: "condition-secret"},
+			}},
+		}},
+	}
+}
+
+func testState(t *testing.T) *state.State {
+	t.Helper()
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("loading state: %v", err)
+	}
+	return st
+}
+
+func triggered(cfg *config.Config) alerts.TriggeredAlert {
+	a := cfg.Alerts[0]
+	return alerts.TriggeredAlert{
+		Key:       alerts.ConditionKey(a.Ticker, a.Conditions[0]),
+		Ticker:    a.Ticker,
+		Name:      a.Name,
+		Alert:     a,
+		Condition: a.Conditions[0],
+		Price:     102500,
+		Direction: "up",
+		Message:   "Bitcoin crossed above $100000.00",
+		Timestamp: time.Now(),
+	}
+}
+
+func TestEnqueueOmitsCredentials(t *testing.T) {
+	cfg := testConfig()
+	st := testState(t)
+	o := New(cfg, st, []notify.Notifier{&recorder{name: "ntfy"}}, false)
+
+	st.Lock()
+	if err := o.Enqueue([]alerts.TriggeredAlert{triggered(cfg)}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	data, _ := json.Marshal(st)
+	st.Unlock()
+
+	for _, secret := range []string{"global-secret", "tk_override_secret", "condition-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("state contains %q:\n%s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), `"ntfy_topic":"crypto"`) {
+		t.Errorf("state doesn't record the ntfy topic:\n%s", data)
+	}
+}
+
+func TestFlushRestoresConfig(t *testing.T) {
+	cfg := testConfig()
+	st := testState(t)
+	r := &recorder{name: "ntfy"}
+	o := New(cfg, st, []notify.Notifier{r}, false)
+
+	st.Lock()
+	o.Enqueue([]alerts.TriggeredAlert{triggered(cfg)})
+	st.Unlock()
+	o.Flush()
+
+	if len(r.alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(r.alerts))
+	}
+	got := r.alerts[0]
+	if got.Alert.Ntfy == nil || got.Alert.Ntfy.Token != "tk_override_secret" {
+		t.Errorf("alert definition wasn't restored from the config: %+v", got.Alert)
+	}
+	if got.Condition.Ntfy == nil || got.Condition.Ntfy.Priority != 5 {
+		t.Errorf("condition wasn't restored from the config: %+v", got.Condition)
+	}
+	if got.Message != "Bitcoin crossed above $100000.00" || got.Price != 102500 {
+		t.Errorf("alert = %+v", got)
+	}
+	if o.Len() != 0 {
+		t.Errorf("%d entries left in the outbox, want 0", o.Len())
+	}
+}
+
+func TestFlushRoutesRemovedConditions(t *testing.T) {
+	cfg := testConfig()
+	st := testState(t)
+	r := &recorder{name: "ntfy"}
+	o := New(cfg, st, []notify.Notifier{r}, false)
+
+	st.Lock()
+	o.Enqueue([]alerts.TriggeredAlert{triggered(cfg)})
+	st.Unlock()
+
+	// The condition is edited before the alert is delivered
+	cfg.Alerts[0].Conditions[0].Value = 110000
+	o.Flush()
+
+	if len(r.alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(r.alerts))
+	}
+	got := r.alerts[0]
+	if got.Alert.TelegramChatID != "-100123" {
+		t.Errorf("telegram chat = %q, want -100123", got.Alert.TelegramChatID)
+	}
+	route := cfg.Ntfy.WithOverrides(got.Alert.Ntfy, got.Condition.Ntfy)
+	if route.Topic != "crypto" || route.Priority != 5 || strings.Join(route.Tags, ",") != "rocket" {
+		t.Errorf("ntfy route = %+v", route)
+	}
+	if got.Condition.Describe() != "above $100000.00" {
+		t.Errorf("condition = %q", got.Condition.Describe())
+	}
+}
+
+// chats is a notifier that routes alerts to per-alert chats, failing for
+// the chats in down
+type chats struct {
+	recorder
+	down map[string]bool
+	sent map[string][]string
+}
+
+func (c *chats) Destination(alert alerts.TriggeredAlert) string {
+	return alert.Alert.TelegramChatID
+}
+
+func (c *chats) SendMessageTo(chat, title, message string) error {
+	if c.down[chat] {
+		return fmt.Errorf("chat %s unreachable", chat)
+	}
+	c.sent[chat] = append(c.sent[chat], title)
+	return nil
+}
+
+func TestFlushGroupsByDestination(t *testing.T) {
+	cfg := testConfig()
+	cfg.Grouping.Mode = "run"
+	cfg.Alerts = nil
+	var queued []alerts.TriggeredAlert
+	for i, chat := range []string{"a", "b", "a", "b", "c"} {
+		a := config.AlertConfig{
+			Ticker:         fmt.Sprintf("T%d", i),
+			TelegramChatID: chat,
+			Conditions:     []config.ConditionConfig{{Type: "above", Value: 10}},
+		}
+		cfg.Alerts = append(cfg.Alerts, a)
+		queued = append(queued, alerts.TriggeredAlert{
+			Key:       alerts.ConditionKey(a.Ticker, a.Conditions[0]),
+			Ticker:    a.Ticker,
+			Alert:     a,
+			Condition: a.Conditions[0],
+			Message:   a.Ticker + " crossed above $10.00",
+			Timestamp: time.Now(),
+		})
+	}
+
+	st := testState(t)
+	n := &chats{recorder: recorder{name: "telegram"}, down: map[string]bool{"b": true}, sent: map[string][]string{}}
+	o := New(cfg, st, []notify.Notifier{n}, false)
+
+	st.Lock()
+	o.Enqueue(queued)
+	st.Unlock()
+	o.Flush()
+
+	if got := n.sent["a"]; len(got) != 1 || got[0] != "2 alerts: T0, T2" {
+		t.Errorf("chat a got %q, want one group of T0 and T2", got)
+	}
+	if len(n.alerts) != 1 || n.alerts[0].Ticker != "T4" {
+		t.Errorf("chat c got %v, want T4 on its own", n.alerts)
+	}
+
+	// Only the alerts for the unreachable chat are retried
+	var pending []string
+	for _, entry := range st.Outbox {
+		pending = append(pending, strings.SplitN(entry.ID, ":", 2)[0])
+	}
+	if strings.Join(pending, ",") != "T1,T3" {
+		t.Errorf("pending = %v, want T1,T3", pending)
+	}
+}
+
+// batches is a batched notifier that fails the alerts at the indexes in
+// down, as a notifier sending several messages does
+type batches struct {
+	recorder
+	down []int
+}
+
+func (b *batches) Batched() bool { return true }
+
+func (b *batches) SendAlerts(triggered []alerts.TriggeredAlert) error {
+	b.alerts = append(b.alerts, triggered...)
+	if len(b.down) == 0 {
+		return nil
+	}
+	return &notify.PartialError{Failed: b.down, Err: fmt.Errorf("status 500")}
+}
+
+func TestFlushRetriesOnlyUndeliveredAlerts(t *testing.T) {
+	cfg := testConfig()
+	cfg.Alerts = nil
+	var queued []alerts.TriggeredAlert
+	for i := 0; i < 4; i++ {
+		a := config.AlertConfig{Ticker: fmt.Sprintf("T%d", i), Conditions: []config.ConditionConfig{{Type: "above", Value: 10}}}
+		cfg.Alerts = append(cfg.Alerts, a)
+		queued = append(queued, alerts.TriggeredAlert{
+			Key:       alerts.ConditionKey(a.Ticker, a.Conditions[0]),
+			Ticker:    a.Ticker,
+			Alert:     a,
+			Condition: a.Conditions[0],
+			Timestamp: time.Now(),
+		})
+	}
+
+	st := testState(t)
+	n := &batches{recorder: recorder{name: "discord"}, down: []int{1, 3}}
+	o := New(cfg, st, []notify.Notifier{n}, false)
+
+	st.Lock()
+	o.Enqueue(queued)
+	st.Unlock()
+	o.Flush()
+
+	var pending []string
+	for _, entry := range st.Outbox {
+		pending = append(pending, strings.SplitN(entry.ID, ":", 2)[0])
+		if entry.Attempts != 1 {
+			t.Errorf("%s: %d attempts, want 1", entry.ID, entry.Attempts)
+		}
+	}
+	if strings.Join(pending, ",") != "T1,T3" {
+		t.Errorf("pending = %v, want T1,T3", pending)
+	}
+}
+
+func TestHeldAlertsExpireAfterTheirWindow(t *testing.T) {
+	cfg := testConfig()
+	cfg.Outbox.MaxAge = "1h"
+	st := testState(t)
+	r := &recorder{name: "ntfy"}
+	o := New(cfg, st, []notify.Notifier{r}, false)
+
+	st.Lock()
+	o.Enqueue([]alerts.TriggeredAlert{triggered(cfg), triggered(cfg)})
+	// Both were queued 8 hours ago; the first was held by quiet hours that
+	// ended a minute ago
+	for i := range st.Outbox {
+		st.Outbox[i].CreatedAt = time.Now().Add(-8 * time.Hour)
+		st.Outbox[i].NextAttempt = time.Now().Add(-time.Minute)
+	}
+	st.Outbox[0].HeldUntil = time.Now().Add(-time.Minute)
+	st.Unlock()
+
+	o.Flush()
+
+	if len(r.alerts) != 1 {
+		t.Errorf("got %d alerts, want the held one delivered", len(r.alerts))
+	}
+	if len(r.messages) != 1 || !strings.Contains(r.messages[0], "Alert not delivered") {
+		t.Errorf("got notices %q, want one expiry notice", r.messages)
+	}
+	if o.Len() != 0 {
+		t.Errorf("%d entries left in the outbox, want 0", o.Len())
+	}
+}
+
+func TestExpiryNoticeOnlyToPendingNotifiers(t *testing.T) {
+	cfg := testConfig()
+	cfg.Outbox.MaxAge = "1h"
+	st := testState(t)
+	slack, email := &recorder{name: "slack"}, &recorder{name: "email", err: fmt.Errorf("smtp down")}
+	o := New(cfg, st, []notify.Notifier{slack, email}, false)
+
+	st.Lock()
+	o.Enqueue([]alerts.TriggeredAlert{triggered(cfg)})
+	st.Unlock()
+
+	// Slack delivers it, email keeps failing until the alert expires
+	o.Flush()
+	if len(slack.alerts) != 1 || len(st.Outbox) != 1 || strings.Join(st.Outbox[0].Pending, ",") != "email" {
+		t.Fatalf("after the first flush: slack got %d alerts, outbox = %+v", len(slack.alerts), st.Outbox)
+	}
+	email.err = nil
+	st.Lock()
+	st.Outbox[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+	st.Outbox[0].NextAttempt = time.Now().Add(-time.Minute)
+	st.Unlock()
+	o.Flush()
+
+	if len(slack.messages) != 0 {
+		t.Errorf("slack got notices %q for an alert it delivered", slack.messages)
+	}
+	if len(email.messages) != 1 || !strings.Contains(email.messages[0], "via email") {
+		t.Errorf("email got notices %q, want one expiry notice", email.messages)
+	}
+	if len(email.alerts) != 0 || o.Len() != 0 {
+		t.Errorf("email got %d alerts and %d entries are left, want the alert dropped", len(email.alerts), o.Len())
+	}
+}
@@ -0,0 +1,121 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/vcavallo/asset-alerts/alerts"
+	"github.com/vcavallo/asset-alerts/config"
+)
+
+// queuedAlert is the part of a triggered alert persisted in the outbox.
+// The alert and condition definitions, which can carry ntfy credentials,
+// aren't stored: they are looked up in the loaded config on delivery. The
+// routing fields are only used if the condition is no longer configured.
+type queuedAlert struct {
+	Key            string    `json:"key"`
+	Ticker         string    `json:"ticker"`
+	Name           string    `json:"name,omitempty"`
+	Title          string    `json:"title,omitempty"`
+	Message        string    `json:"message"`
+	Price          float64   `json:"price"`
+	ReferencePrice float64   `json:"reference_price,omitempty"`
+	Direction      string    `json:"direction,omitempty"`
+	Currency       string    `json:"currency,omitempty"`
+	Reminder       bool      `json:"reminder,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+
+	Type           string   `json:"type"`
+	Value          float64  `json:"value,omitempty"`
+	Period         string   `json:"period,omitempty"`
+	Priority       int      `json:"priority,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Group          string   `json:"group,omitempty"`
+	NtfyServer     string   `json:"ntfy_server,omitempty"`
+	NtfyTopic      string   `json:"ntfy_topic,omitempty"`
+	TelegramChatID string   `json:"telegram_chat_id,omitempty"`
+	MatrixRoomID   string   `json:"matrix_room_id,omitempty"`
+}
+
+// queue returns the persisted form of alert
+func queue(alert alerts.TriggeredAlert) queuedAlert {
+	// Only the overrides are recorded, without their credentials
+	route := config.NtfyConfig{}.WithOverrides(alert.Alert.Ntfy, alert.Condition.Ntfy)
+
+	return queuedAlert{
+		Key:            alert.Key,
+		Ticker:         alert.Ticker,
+		Name:           alert.Name,
+		Title:          alert.Title,
+		Message:        alert.Message,
+		Price:          alert.Price,
+		ReferencePrice: alert.ReferencePrice,
+		Direction:      alert.Direction,
+		Currency:       alert.Currency,
+		Reminder:       alert.Reminder,
+		Timestamp:      alert.Timestamp,
+		Type:           alert.Condition.Type,
+		Value:          alert.Condition.Value,
+		Period:         alert.Condition.Period,
+		Priority:       route.Priority,
+		Tags:           route.Tags,
+		Group:          alert.Alert.Group,
+		NtfyServer:     route.Server,
+		NtfyTopic:      route.Topic,
+		TelegramChatID: alert.Alert.TelegramChatID,
+		MatrixRoomID:   alert.Alert.MatrixRoomID,
+	}
+}
+
+// restore rebuilds a triggered alert from its persisted form, taking the
+// alert and condition definitions from the config
+func (o *Outbox) restore(q queuedAlert) alerts.TriggeredAlert {
+	alert := alerts.TriggeredAlert{
+		Key:            q.Key,
+		Ticker:         q.Ticker,
+		Name:           q.Name,
+		Title:          q.Title,
+		Message:        q.Message,
+		Price:          q.Price,
+		ReferencePrice: q.ReferencePrice,
+		Direction:      q.Direction,
+		Currency:       q.Currency,
+		Reminder:       q.Reminder,
+		Timestamp:      q.Timestamp,
+	}
+
+	if a, cond, ok := o.lookup(q.Key); ok {
+		alert.Alert, alert.Condition = a, cond
+		return alert
+	}
+
+	// The condition was edited or removed since the alert was queued, so
+	// route it with what was recorded. Credentials still come from the
+	// global ntfy settings when the server is unchanged.
+	alert.Alert = config.AlertConfig{
+		Ticker:         q.Ticker,
+		Name:           q.Name,
+		Group:          q.Group,
+		TelegramChatID: q.TelegramChatID,
+		MatrixRoomID:   q.MatrixRoomID,
+		Ntfy:           &config.NtfyOverride{Server: q.NtfyServer, Topic: q.NtfyTopic},
+	}
+	alert.Condition = config.ConditionConfig{
+		Type:   q.Type,
+		Value:  q.Value,
+		Period: q.Period,
+		Ntfy:   &config.NtfyOverride{Priority: q.Priority, Tags: q.Tags},
+	}
+	return alert
+}
+
+// lookup finds the configured alert and condition with the given state key
+func (o *Outbox) lookup(key string) (config.AlertConfig, config.ConditionConfig, bool) {
+	for _, a := range o.cfg.Alerts {
+		for _, cond := range a.Conditions {
+			if alerts.ConditionKey(a.Ticker, cond) == key {
+				return a, cond, true
+			}
+		}
+	}
+	return config.AlertConfig{}, config.ConditionConfig{}, false
+}
@@ -0,0 +1,23 @@
+// Package period parses the durations used in config and expressions
+package period
+
+import (
+	"fmt"
+	"time"
+)
+
+// Parse converts period strings like "24h", "1h", "7d" to time.Duration:
+// Go durations plus a "d" suffix for days
+func Parse(period string) (time.Duration, error) {
+	// Handle day suffix
+	if len(period) > 1 && period[len(period)-1] == 'd' {
+		var days int
+		if _, err := fmt.Sscanf(period, "%dd", &days); err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	// Standard Go duration parsing for hours, minutes, etc.
+	return time.ParseDuration(period)
+}
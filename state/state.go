@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -12,30 +14,127 @@ type State struct {
 	// Prices maps ticker -> current price info
 	Prices map[string]PriceRecord `json:"prices"`
 
-	// TriggeredAlerts tracks which alerts have been triggered
-	// Key format: "ticker:type:value" (e.g., "BTC-USD:above:100000")
-	TriggeredAlerts map[string]bool `json:"triggered_alerts"`
+	// Conditions tracks the trigger/re-arm state machine of each alert condition
+	// Key format: the ticker and condition definition (e.g., "BTC-USD:percent_change:5.00:24h")
+	Conditions map[string]ConditionState `json:"conditions"`
+
+	// TriggeredAlerts is the format used before Conditions. It is only read
+	// to migrate old state files.
+	TriggeredAlerts map[string]bool `json:"triggered_alerts,omitempty"`
 
 	// PriceHistory stores historical prices for percent change calculations
 	// Key format: "ticker" -> list of price records
 	PriceHistory map[string][]PriceRecord `json:"price_history"`
 
+	// Backfilled maps ticker -> the earliest time history has been requested
+	// back to from Yahoo, so that a ticker with a short listing history isn't
+	// fetched again on every run
+	Backfilled map[string]time.Time `json:"backfilled"`
+
+	// Extremes maps ticker -> the highs and lows record conditions compare against
+	Extremes map[string]Extremes `json:"extremes"`
+
+	// HighWaterMarks maps condition key -> the peak price a trailing stop or
+	// drawdown condition measures from
+	HighWaterMarks map[string]HighWaterMark `json:"high_water_marks"`
+
+	// Snoozed maps alert key -> time until which the alert is suppressed
+	Snoozed map[string]time.Time `json:"snoozed"`
+
+	// Acknowledged tracks alerts the user has acknowledged. An acknowledgement
+	// silences reminders and retries until the alert re-arms.
+	Acknowledged map[string]bool `json:"acknowledged"`
+
+	// Outbox holds triggered alerts that haven't been delivered to every notifier yet
+	Outbox []OutboxEntry `json:"outbox"`
+
+	// DigestsSent maps digest name and notifier ("name/notifier") -> when
+	// the digest was last sent through the notifier
+	DigestsSent map[string]time.Time `json:"digests_sent"`
+
 	path string
+	mu   sync.Mutex
+}
+
+// Phase is where an alert condition is in its trigger/re-arm cycle
+type Phase string
+
+const (
+	PhaseArmed     Phase = "armed"     // waiting for the condition to hold
+	PhaseTriggered Phase = "triggered" // notified; waiting for the condition to clear
+	PhaseCooling   Phase = "cooling"   // cleared within its cooldown; re-arms when the cooldown ends
+)
+
+// ConditionState is the persisted state machine of one alert condition
+type ConditionState struct {
+	Phase     Phase     `json:"phase"`
+	Since     time.Time `json:"since"`      // when the condition entered the phase
+	LastFired time.Time `json:"last_fired"` // when the condition last sent a notification
+	Active    bool      `json:"active"`     // whether the condition held on the last check
+}
+
+// Extremes are a ticker's record prices
+type Extremes struct {
+	High52w     float64 `json:"high_52w"`      // Yahoo's 52-week high at the last check
+	Low52w      float64 `json:"low_52w"`       // Yahoo's 52-week low at the last check
+	AllTimeHigh float64 `json:"all_time_high"` // highest price seen, 0 if unknown
+}
+
+// HighWaterMark is the highest price seen by a trailing stop or drawdown
+// condition since it started tracking
+type HighWaterMark struct {
+	High    float64   `json:"high"`
+	Since   time.Time `json:"since"`   // when tracking started or last restarted
+	Stopped bool      `json:"stopped"` // the stop was hit and the condition is set never to reset
 }
 
 // PriceRecord represents a price at a point in time
 type PriceRecord struct {
 	Price     float64   `json:"price"`
+	High      float64   `json:"high,omitempty"`   // highest price since the previous record, 0 if only Price is known
+	Low       float64   `json:"low,omitempty"`    // lowest price since the previous record, 0 if only Price is known
+	Volume    int64     `json:"volume,omitempty"` // volume traded so far that UTC day, 0 if unknown
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// Range returns the highest and lowest price since the previous record,
+// which is just Price when no range was recorded
+func (r PriceRecord) Range() (float64, float64) {
+	high, low := r.Price, r.Price
+	if r.High > 0 {
+		high = max(high, r.High)
+	}
+	if r.Low > 0 {
+		low = min(low, r.Low)
+	}
+	return high, low
+}
+
+// OutboxEntry is a triggered alert awaiting delivery
+type OutboxEntry struct {
+	ID          string          `json:"id"`
+	Alert       json.RawMessage `json:"alert"`   // the alert's message and routing, without its config
+	Pending     []string        `json:"pending"` // names of notifiers still to deliver to
+	Attempts    int             `json:"attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+	HeldUntil   time.Time       `json:"held_until"` // end of the quiet hours the alert was held for, if any
+}
+
 // Load reads state from a JSON file, or creates new state if file doesn't exist
 func Load(path string) (*State, error) {
 	s := &State{
-		Prices:          make(map[string]PriceRecord),
-		TriggeredAlerts: make(map[string]bool),
-		PriceHistory:    make(map[string][]PriceRecord),
-		path:            path,
+		Prices:         make(map[string]PriceRecord),
+		Conditions:     make(map[string]ConditionState),
+		PriceHistory:   make(map[string][]PriceRecord),
+		Backfilled:     make(map[string]time.Time),
+		Extremes:       make(map[string]Extremes),
+		HighWaterMarks: make(map[string]HighWaterMark),
+		Snoozed:        make(map[string]time.Time),
+		Acknowledged:   make(map[string]bool),
+		DigestsSent:    make(map[string]time.Time),
+		path:           path,
 	}
 
 	data, err := os.ReadFile(path)
@@ -55,10 +154,90 @@ func Load(path string) (*State, error) {
 		return nil, fmt.Errorf("parsing state file: %w", err)
 	}
 
+	if s.Backfilled == nil {
+		s.Backfilled = make(map[string]time.Time)
+	}
+	if s.Extremes == nil {
+		s.Extremes = make(map[string]Extremes)
+	}
+	if s.HighWaterMarks == nil {
+		s.HighWaterMarks = make(map[string]HighWaterMark)
+	}
+	s.migrate()
+
 	s.path = path
 	return s, nil
 }
 
+// migrate converts triggered flags from older state files into condition states
+func (s *State) migrate() {
+	for key, triggered := range s.TriggeredAlerts {
+		if _, ok := s.Conditions[key]; ok {
+			continue
+		}
+		phase := PhaseArmed
+		if triggered {
+			phase = PhaseTriggered
+		}
+		s.Conditions[key] = ConditionState{Phase: phase}
+	}
+	s.TriggeredAlerts = nil
+}
+
+// MigrateKeys moves the state of conditions recorded under older keys to the
+// keys that replaced them, which depend on the config, so unlike migrate it
+// is run once the config is loaded. renames maps each old key to its new
+// keys; an old key shared by several conditions is copied to each of them.
+// New keys that already have state keep it.
+func (s *State) MigrateKeys(renames map[string][]string) {
+	for old, keys := range renames {
+		cs, hasCondition := s.Conditions[old]
+		until, snoozed := s.Snoozed[old]
+		acked := s.Acknowledged[old]
+
+		for _, key := range keys {
+			if _, ok := s.Conditions[key]; ok || key == old {
+				continue
+			}
+			if hasCondition {
+				s.Conditions[key] = cs
+			}
+			if snoozed {
+				s.Snoozed[key] = until
+			}
+			if acked {
+				s.Acknowledged[key] = true
+			}
+		}
+
+		if !contains(keys, old) {
+			delete(s.Conditions, old)
+			delete(s.Snoozed, old)
+			delete(s.Acknowledged, old)
+		}
+	}
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Lock serializes access to the state between the check loop and the
+// callback server in daemon mode
+func (s *State) Lock() {
+	s.mu.Lock()
+}
+
+// Unlock releases the lock taken by Lock
+func (s *State) Unlock() {
+	s.mu.Unlock()
+}
+
 // Save writes state to the JSON file
 func (s *State) Save() error {
 	data, err := json.MarshalIndent(s, "", "  ")
@@ -66,17 +245,21 @@ func (s *State) Save() error {
 		return fmt.Errorf("marshaling state: %w", err)
 	}
 
-	if err := os.WriteFile(s.path, data, 0644); err != nil {
+	// The file holds alert messages and routing, so only the owner can read it
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
 		return fmt.Errorf("writing state file: %w", err)
 	}
 
 	return nil
 }
 
-// UpdatePrice records a new price for a ticker
-func (s *State) UpdatePrice(ticker string, price float64) {
+// UpdatePrice records a new price and the session's volume so far for a
+// ticker, keeping history for retention. History more than a day old is
+// thinned to the last record in each interval of resolution.
+func (s *State) UpdatePrice(ticker string, price float64, volume int64, retention, resolution time.Duration) {
 	record := PriceRecord{
 		Price:     price,
+		Volume:    volume,
 		Timestamp: time.Now(),
 	}
 
@@ -85,8 +268,63 @@ func (s *State) UpdatePrice(ticker string, price float64) {
 	// Add to history
 	s.PriceHistory[ticker] = append(s.PriceHistory[ticker], record)
 
-	// Prune old history (keep last 7 days)
-	s.pruneHistory(ticker, 7*24*time.Hour)
+	s.pruneHistory(ticker, retention)
+	s.downsampleHistory(ticker, resolution)
+}
+
+// UpdateExtremes records Yahoo's 52-week range for a ticker and raises its
+// all-time high if price or the 52-week high exceeds it. Zero values are
+// treated as not reported.
+func (s *State) UpdateExtremes(ticker string, price, high52w, low52w float64) {
+	x := s.Extremes[ticker]
+	if high52w > 0 {
+		x.High52w = high52w
+	}
+	if low52w > 0 {
+		x.Low52w = low52w
+	}
+	x.AllTimeHigh = max(x.AllTimeHigh, price, high52w)
+	s.Extremes[ticker] = x
+}
+
+// HighWaterMark returns a condition's high-water mark, and false if it
+// hasn't started tracking
+func (s *State) HighWaterMark(key string) (HighWaterMark, bool) {
+	m, ok := s.HighWaterMarks[key]
+	return m, ok
+}
+
+// SetHighWaterMark records a condition's high-water mark
+func (s *State) SetHighWaterMark(key string, m HighWaterMark) {
+	s.HighWaterMarks[key] = m
+}
+
+// HistoryStart returns the time of the oldest recorded price for a ticker
+func (s *State) HistoryStart(ticker string) (time.Time, bool) {
+	history := s.PriceHistory[ticker]
+	if len(history) == 0 {
+		return time.Time{}, false
+	}
+	return history[0].Timestamp, true
+}
+
+// Backfill adds past prices from before the recorded history. Records at or
+// after the oldest recorded price are ignored, so recorded prices win.
+func (s *State) Backfill(ticker string, records []PriceRecord, from time.Time) {
+	start, ok := s.HistoryStart(ticker)
+
+	var older []PriceRecord
+	for _, record := range records {
+		if !ok || record.Timestamp.Before(start) {
+			older = append(older, record)
+		}
+	}
+	sort.Slice(older, func(i, j int) bool {
+		return older[i].Timestamp.Before(older[j].Timestamp)
+	})
+
+	s.PriceHistory[ticker] = append(older, s.PriceHistory[ticker]...)
+	s.Backfilled[ticker] = from
 }
 
 // GetLastPrice returns the last known price for a ticker
@@ -126,19 +364,115 @@ func (s *State) GetPriceAtTime(ticker string, ago time.Duration) (float64, bool)
 	return closest.Price, true
 }
 
-// AlertKey generates a unique key for an alert condition
+// GetHistory returns the price records for a ticker from the last window
+func (s *State) GetHistory(ticker string, window time.Duration) []PriceRecord {
+	cutoff := time.Now().Add(-window)
+
+	var records []PriceRecord
+	for _, record := range s.PriceHistory[ticker] {
+		if record.Timestamp.After(cutoff) {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+// AlertKey returns the key threshold and change conditions had in older
+// state files, made of the ticker, type and value
 func AlertKey(ticker, alertType string, value float64) string {
 	return fmt.Sprintf("%s:%s:%.2f", ticker, alertType, value)
 }
 
-// IsAlertTriggered checks if an alert has already been triggered
-func (s *State) IsAlertTriggered(key string) bool {
-	return s.TriggeredAlerts[key]
+// HasAlert checks if the state has seen an alert with this key
+func (s *State) HasAlert(key string) bool {
+	_, ok := s.Conditions[key]
+	return ok
+}
+
+// Condition returns the state of an alert condition. Conditions that haven't
+// been seen yet are armed.
+func (s *State) Condition(key string) ConditionState {
+	cs, ok := s.Conditions[key]
+	if !ok || cs.Phase == "" {
+		cs.Phase = PhaseArmed
+	}
+	return cs
 }
 
-// SetAlertTriggered marks an alert as triggered
-func (s *State) SetAlertTriggered(key string, triggered bool) {
-	s.TriggeredAlerts[key] = triggered
+// SetPhase moves an alert condition to phase at t. Leaving the triggered
+// phase clears any acknowledgement.
+func (s *State) SetPhase(key string, phase Phase, t time.Time) {
+	cs := s.Condition(key)
+	if cs.Phase != phase || !s.HasAlert(key) {
+		cs.Phase = phase
+		cs.Since = t
+	}
+	s.Conditions[key] = cs
+
+	if phase != PhaseTriggered {
+		delete(s.Acknowledged, key)
+	}
+}
+
+// SetActive records whether an alert condition held on the latest check
+func (s *State) SetActive(key string, active bool) {
+	cs := s.Condition(key)
+	cs.Active = active
+	s.Conditions[key] = cs
+}
+
+// RecordFired notes that an alert condition sent a notification at t
+func (s *State) RecordFired(key string, t time.Time) {
+	cs := s.Condition(key)
+	cs.LastFired = t
+	s.Conditions[key] = cs
+}
+
+// Snooze suppresses an alert until the given time. The alert is re-armed so
+// that it fires again after the snooze if the condition still holds.
+func (s *State) Snooze(key string, until time.Time) {
+	s.Snoozed[key] = until
+	s.SetPhase(key, PhaseArmed, time.Now())
+}
+
+// IsSnoozed checks if an alert is currently snoozed, forgetting expired snoozes
+func (s *State) IsSnoozed(key string) bool {
+	until, ok := s.Snoozed[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(s.Snoozed, key)
+		return false
+	}
+	return true
+}
+
+// Acknowledge marks an alert as acknowledged by the user
+func (s *State) Acknowledge(key string) {
+	s.Acknowledged[key] = true
+}
+
+// IsAcknowledged checks if an alert has been acknowledged since it last fired
+func (s *State) IsAcknowledged(key string) bool {
+	return s.Acknowledged[key]
+}
+
+// DigestSent returns when a digest was last sent through a notifier, and
+// false if the digest hasn't been seen yet
+func (s *State) DigestSent(name, notifier string) (time.Time, bool) {
+	if t, ok := s.DigestsSent[name+"/"+notifier]; ok {
+		return t, true
+	}
+	// Older state files recorded one time per digest
+	t, ok := s.DigestsSent[name]
+	return t, ok
+}
+
+// SetDigestSent records when a digest was sent through a notifier
+func (s *State) SetDigestSent(name, notifier string, t time.Time) {
+	s.DigestsSent[name+"/"+notifier] = t
 }
 
 // pruneHistory removes price records older than maxAge
@@ -159,3 +493,38 @@ func (s *State) pruneHistory(ticker string, maxAge time.Duration) {
 
 	s.PriceHistory[ticker] = pruned
 }
+
+// downsampleHistory keeps only the last price record in each interval of
+// resolution among the records more than a day old, so that a long retention
+// doesn't keep the price from every check. The last record of an interval is
+// its close, and its volume the day's running total at that time; its high
+// and low are widened to cover the records dropped before it.
+func (s *State) downsampleHistory(ticker string, resolution time.Duration) {
+	history := s.PriceHistory[ticker]
+	if resolution <= 0 || len(history) == 0 {
+		return
+	}
+
+	cutoff := time.Now().Add(-24 * time.Hour)
+	var kept []PriceRecord
+	var high, low float64 // range of the records dropped since the last kept one
+	for i, record := range history {
+		h, l := record.Range()
+		if high > 0 {
+			h, l = max(h, high), min(l, low)
+		}
+		if record.Timestamp.Before(cutoff) && i+1 < len(history) &&
+			history[i+1].Timestamp.Before(cutoff) &&
+			history[i+1].Timestamp.Truncate(resolution).Equal(record.Timestamp.Truncate(resolution)) {
+			high, low = h, l
+			continue
+		}
+		high, low = 0, 0
+		if h != record.Price || l != record.Price {
+			record.High, record.Low = h, l
+		}
+		kept = append(kept, record)
+	}
+
+	s.PriceHistory[ticker] = kept
+}
@@ -0,0 +1,118 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpdatePriceDownsamplesOldHistory(t *testing.T) {
+	st, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Five-minute checks over the last three days
+	now := time.Now()
+	start := now.Add(-72 * time.Hour).Truncate(time.Hour)
+	var records []PriceRecord
+	for ts := start; ts.Before(now); ts = ts.Add(5 * time.Minute) {
+		records = append(records, PriceRecord{Price: float64(ts.Unix()), Timestamp: ts})
+	}
+	st.Backfill("AAPL", records, start)
+
+	st.UpdatePrice("AAPL", 1, 0, 7*24*time.Hour, time.Hour)
+
+	cutoff := now.Add(-24 * time.Hour)
+	history := st.PriceHistory["AAPL"]
+	seen := make(map[time.Time]bool)
+	var recent int
+	for i, r := range history {
+		if i > 0 && !r.Timestamp.After(history[i-1].Timestamp) {
+			t.Fatalf("history out of order at %d", i)
+		}
+		if !r.Timestamp.Before(cutoff) {
+			recent++
+			continue
+		}
+		hour := r.Timestamp.Truncate(time.Hour)
+		if seen[hour] {
+			t.Fatalf("more than one record kept for %s", hour)
+		}
+		seen[hour] = true
+		// Hours entirely before the cutoff keep their last check
+		if want := hour.Add(55 * time.Minute); hour.Add(time.Hour).Before(cutoff) && !r.Timestamp.Equal(want) {
+			t.Errorf("kept %s for %s, want the hour's last record at %s", r.Timestamp, hour, want)
+		}
+	}
+
+	if len(seen) < 47 || len(seen) > 49 {
+		t.Errorf("kept %d hourly records older than a day, want about 48", len(seen))
+	}
+	// Every five-minute check from the last day stays, plus the new price
+	if recent < 24*12 {
+		t.Errorf("kept %d records from the last day, want every one", recent)
+	}
+	if last := history[len(history)-1]; last.Price != 1 {
+		t.Errorf("last record is %v, want the new price", last.Price)
+	}
+}
+
+func TestUpdatePriceKeepsHistoryWithinRetention(t *testing.T) {
+	st, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	st.Backfill("AAPL", []PriceRecord{
+		{Price: 90, Timestamp: now.Add(-10 * 24 * time.Hour)},
+		{Price: 95, Timestamp: now.Add(-3 * 24 * time.Hour)},
+	}, now.Add(-10*24*time.Hour))
+
+	st.UpdatePrice("AAPL", 100, 0, 7*24*time.Hour, 24*time.Hour)
+
+	history := st.PriceHistory["AAPL"]
+	if len(history) != 2 || history[0].Price != 95 || history[1].Price != 100 {
+		t.Errorf("history = %+v, want the 95 and 100 records", history)
+	}
+}
+
+func TestDownsampleKeepsRanges(t *testing.T) {
+	st, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Checks within one hour two days ago, then one on its own the hour after
+	hour := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+	st.Backfill("AAPL", []PriceRecord{
+		{Price: 100, Timestamp: hour},
+		{Price: 104, High: 107, Low: 103, Timestamp: hour.Add(10 * time.Minute)},
+		{Price: 97, Timestamp: hour.Add(20 * time.Minute)},
+		{Price: 101, Timestamp: hour.Add(50 * time.Minute)},
+		{Price: 102, Timestamp: hour.Add(70 * time.Minute)},
+	}, hour)
+
+	st.UpdatePrice("AAPL", 105, 0, 7*24*time.Hour, time.Hour)
+
+	history := st.PriceHistory["AAPL"]
+	want := []PriceRecord{
+		{Price: 101, High: 107, Low: 97, Timestamp: hour.Add(50 * time.Minute)},
+		{Price: 102, Timestamp: hour.Add(70 * time.Minute)},
+	}
+	if len(history) != 3 {
+		t.Fatalf("history = %+v, want the hour's close, the next hour and the new price", history)
+	}
+	for i, w := range want {
+		if history[i] != w {
+			t.Errorf("record %d = %+v, want %+v", i, history[i], w)
+		}
+	}
+
+	// Thinning again leaves the ranges as they are
+	st.UpdatePrice("AAPL", 106, 0, 7*24*time.Hour, time.Hour)
+	if got := st.PriceHistory["AAPL"][0]; got != want[0] {
+		t.Errorf("after another update, record 0 = %+v, want %+v", got, want[0])
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 )
 
 const (
 	baseURL    = "https://query1.finance.yahoo.com/v8/finance/chart"
+	quoteURL   = "https://finance.yahoo.com/quote"
 	userAgent  = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36"
 	timeoutSec = 10
 )
@@ -23,19 +25,46 @@ type Quote struct {
 	Ticker        string
 	Price         float64
 	PreviousClose float64
+	Currency      string
+	Volume        int64   // shares or units traded so far in the current session
+	High52w       float64 // 52-week high, 0 if not reported
+	Low52w        float64 // 52-week low, 0 if not reported
 	Timestamp     time.Time
 }
 
+// Candle is the closing price, high, low and volume traded in one interval of
+// Yahoo's historical data
+type Candle struct {
+	Time   time.Time
+	Close  float64
+	High   float64
+	Low    float64
+	Volume int64
+}
+
 // chartResponse represents the Yahoo Finance API response
 type chartResponse struct {
 	Chart struct {
 		Result []struct {
 			Meta struct {
-				Symbol             string  `json:"symbol"`
-				RegularMarketPrice float64 `json:"regularMarketPrice"`
-				PreviousClose      float64 `json:"previousClose"`
-				RegularMarketTime  int64   `json:"regularMarketTime"`
+				Symbol              string  `json:"symbol"`
+				RegularMarketPrice  float64 `json:"regularMarketPrice"`
+				PreviousClose       float64 `json:"previousClose"`
+				RegularMarketTime   int64   `json:"regularMarketTime"`
+				RegularMarketVolume int64   `json:"regularMarketVolume"`
+				FiftyTwoWeekHigh    float64 `json:"fiftyTwoWeekHigh"`
+				FiftyTwoWeekLow     float64 `json:"fiftyTwoWeekLow"`
+				Currency            string  `json:"currency"`
 			} `json:"meta"`
+			Timestamp  []int64 `json:"timestamp"`
+			Indicators struct {
+				Quote []struct {
+					Close  []*float64 `json:"close"` // null for intervals without trades
+					High   []*float64 `json:"high"`
+					Low    []*float64 `json:"low"`
+					Volume []*int64   `json:"volume"`
+				} `json:"quote"`
+			} `json:"indicators"`
 		} `json:"result"`
 		Error *struct {
 			Code        string `json:"code"`
@@ -53,10 +82,85 @@ func NewClient() *Client {
 	}
 }
 
+// QuoteURL returns the Yahoo Finance quote page for a ticker
+func QuoteURL(ticker string) string {
+	return fmt.Sprintf("%s/%s", quoteURL, url.PathEscape(ticker))
+}
+
 // GetQuote fetches the current price for a ticker
 func (c *Client) GetQuote(ticker string) (*Quote, error) {
-	url := fmt.Sprintf("%s/%s", baseURL, ticker)
+	chartResp, err := c.getChart(fmt.Sprintf("%s/%s", baseURL, ticker))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chartResp.Chart.Result) == 0 {
+		return nil, fmt.Errorf("no data returned for ticker %s", ticker)
+	}
+
+	meta := chartResp.Chart.Result[0].Meta
+
+	return &Quote{
+		Ticker:        meta.Symbol,
+		Price:         meta.RegularMarketPrice,
+		PreviousClose: meta.PreviousClose,
+		Currency:      meta.Currency,
+		Volume:        meta.RegularMarketVolume,
+		High52w:       meta.FiftyTwoWeekHigh,
+		Low52w:        meta.FiftyTwoWeekLow,
+		Timestamp:     time.Unix(meta.RegularMarketTime, 0),
+	}, nil
+}
+
+// GetHistory fetches closing prices, highs and volumes for a ticker between start and end,
+// oldest first. Interval is one of Yahoo's bar sizes, e.g. "5m", "1h", "1d".
+func (c *Client) GetHistory(ticker string, start, end time.Time, interval string) ([]Candle, error) {
+	query := url.Values{}
+	query.Set("period1", fmt.Sprint(start.Unix()))
+	query.Set("period2", fmt.Sprint(end.Unix()))
+	query.Set("interval", interval)
+
+	chartResp, err := c.getChart(fmt.Sprintf("%s/%s?%s", baseURL, ticker, query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chartResp.Chart.Result) == 0 {
+		return nil, fmt.Errorf("no data returned for ticker %s", ticker)
+	}
+
+	result := chartResp.Chart.Result[0]
+	if len(result.Indicators.Quote) == 0 {
+		return nil, nil
+	}
+	closes := result.Indicators.Quote[0].Close
+	highs := result.Indicators.Quote[0].High
+	lows := result.Indicators.Quote[0].Low
+	volumes := result.Indicators.Quote[0].Volume
+
+	var candles []Candle
+	for i, ts := range result.Timestamp {
+		if i >= len(closes) || closes[i] == nil {
+			continue
+		}
+		candle := Candle{Time: time.Unix(ts, 0), Close: *closes[i], High: *closes[i], Low: *closes[i]}
+		if i < len(highs) && highs[i] != nil {
+			candle.High = *highs[i]
+		}
+		if i < len(lows) && lows[i] != nil {
+			candle.Low = *lows[i]
+		}
+		if i < len(volumes) && volumes[i] != nil {
+			candle.Volume = *volumes[i]
+		}
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
 
+// getChart fetches and decodes a chart API response
+func (c *Client) getChart(url string) (*chartResponse, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
@@ -66,7 +170,7 @@ func (c *Client) GetQuote(ticker string) (*Quote, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("fetching quote: %w", err)
+		return nil, fmt.Errorf("fetching chart: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -85,18 +189,7 @@ func (c *Client) GetQuote(ticker string) (*Quote, error) {
 			chartResp.Chart.Error.Description)
 	}
 
-	if len(chartResp.Chart.Result) == 0 {
-		return nil, fmt.Errorf("no data returned for ticker %s", ticker)
-	}
-
-	meta := chartResp.Chart.Result[0].Meta
-
-	return &Quote{
-		Ticker:        meta.Symbol,
-		Price:         meta.RegularMarketPrice,
-		PreviousClose: meta.PreviousClose,
-		Timestamp:     time.Unix(meta.RegularMarketTime, 0),
-	}, nil
+	return &chartResp, nil
 }
 
 // GetQuotes fetches prices for multiple tickers